@@ -3,28 +3,58 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 
 	"github.com/peyuaa/raft/internal/cluster"
 	"github.com/peyuaa/raft/internal/handler"
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/rpc"
+	"github.com/peyuaa/raft/internal/store"
+	"github.com/peyuaa/raft/internal/transport"
 )
 
 type Config struct {
-	NodesNumber int `yaml:"nodes_number"`
+	NodesNumber       int           `yaml:"nodes_number"`
+	Codec             string        `yaml:"codec"`
+	RequestTimeout    time.Duration `yaml:"request_timeout"`
+	Stores            []string      `yaml:"stores"`
+	SendQueueSize     int           `yaml:"send_queue_size"`
+	DropPolicy        string        `yaml:"drop_policy"`
+	ClusterSecret     string        `yaml:"cluster_secret"`
+	CompressThreshold int           `yaml:"compress_threshold"`
 }
 
 const (
 	configFile = "config.yaml"
+
+	defaultRequestTimeout = 5 * time.Second
+)
+
+var (
+	configPath = flag.String("config", configFile, "path to the config file")
+	httpAddr   = flag.String("http", ":8080", "address of the HTTP API")
+	listen     = flag.String("listen", "", "raft address to listen on; runs a single node that talks TCP to -peers")
+	nodeID     = flag.String("id", "", "id of the single node, a UUID")
+	peers      = flag.String("peers", "", "comma-separated id=host:port of the other nodes")
+	wireName   = flag.String("wire", "json", "encoding of messages between nodes: json or proto")
 )
 
 func main() {
-	yamlFile, err := os.ReadFile(configFile)
+	flag.Parse()
+
+	yamlFile, err := os.ReadFile(*configPath)
 	if err != nil {
 		log.Fatalf("unable to read config file: %v", err)
 	}
@@ -35,7 +65,45 @@ func main() {
 		log.Fatalf("unable to parse config file: %v", err)
 	}
 
-	r, err := cluster.New(cfg.NodesNumber)
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = defaultRequestTimeout
+	}
+
+	codec, err := journal.CodecByName(cfg.Codec)
+	if err != nil {
+		log.Fatalf("unable to select codec: %v", err)
+	}
+
+	queue := transport.DefaultQueue
+	if cfg.SendQueueSize > 0 {
+		queue.Size = cfg.SendQueueSize
+	}
+	queue.Policy, err = transport.ParseDropPolicy(cfg.DropPolicy)
+	if err != nil {
+		log.Fatalf("unable to select drop policy: %v", err)
+	}
+
+	newStore := func() (*store.Store, journal.Processor, error) {
+		s, err := store.New(cfg.Stores...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.Registry(), nil
+	}
+
+	var r *handler.Cluster
+	if *listen == "" {
+		r, err = cluster.NewWith[any](cfg.NodesNumber, codec, newStore)
+		if err == nil {
+			r.Network.SetQueue(queue)
+		}
+	} else {
+		var tcp *transport.TCP
+		r, tcp, err = singleNode(cfg, codec, queue, newStore)
+		if tcp != nil {
+			defer tcp.Close()
+		}
+	}
 	if err != nil {
 		log.Fatalf("unable to create raft cluster: %v", err)
 	}
@@ -52,21 +120,40 @@ func main() {
 		}
 	}()
 
-	h := handler.New(r)
+	h := handler.New(r, cfg.RequestTimeout)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/nodes", h.Nodes)
 	mux.HandleFunc("/journal", h.Journal)
 	mux.HandleFunc("/request", h.Request)
+	mux.HandleFunc("/delete", h.Delete)
+	mux.HandleFunc("/put-if-absent", h.PutIfAbsent)
+	mux.HandleFunc("/cas", h.CompareAndSwap)
+	mux.HandleFunc("/incr", h.Increment)
+	mux.HandleFunc("/decr", h.Decrement)
+	mux.HandleFunc("/txn", h.Txn)
+	mux.HandleFunc("/compact", h.Compact)
+	mux.HandleFunc("/lock/acquire", h.LockAcquire)
+	mux.HandleFunc("/lock/renew", h.LockRenew)
+	mux.HandleFunc("/lock/release", h.LockRelease)
+	mux.HandleFunc("/queue/enqueue", h.Enqueue)
+	mux.HandleFunc("/queue/dequeue", h.Dequeue)
+	mux.HandleFunc("/queue/ack", h.Ack)
+	mux.HandleFunc("/queue/nack", h.Nack)
 	mux.HandleFunc("/kill", h.Kill)
 	mux.HandleFunc("/recover", h.Recover)
 	mux.HandleFunc("/dump", h.DumpMap)
 	mux.HandleFunc("/get", h.Get)
+	mux.HandleFunc("/scan", h.Scan)
+	mux.HandleFunc("/watch", h.Watch)
 	mux.HandleFunc("/connect", h.Connect)
 	mux.HandleFunc("/disconnect", h.Disconnect)
+	mux.HandleFunc("/link", h.Link)
+	mux.HandleFunc("/partition", h.Partition)
+	mux.HandleFunc("/heal", h.Heal)
 	mux.HandleFunc("/topology", h.Topology)
 
 	s := http.Server{
-		Addr:    ":8080",
+		Addr:    *httpAddr,
 		Handler: mux,
 	}
 
@@ -92,3 +179,57 @@ func main() {
 	cancel()
 	<-ctx.Done()
 }
+
+// singleNode creates the one node this process runs in a multi-process
+// cluster, talking to its peers over TCP. With a cluster secret every
+// connection is authenticated, see TCP.SetSecret.
+func singleNode(cfg Config, codec journal.Codec, queue transport.QueueConfig, newStore func() (*store.Store, journal.Processor, error)) (*handler.Cluster, *transport.TCP, error) {
+	id, err := uuid.Parse(*nodeID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid node id: %w", err)
+	}
+
+	var wire transport.Wire
+	switch *wireName {
+	case "json":
+		wire = transport.JSON{}
+	case "proto":
+		wire = rpc.Wire{}
+	default:
+		return nil, nil, fmt.Errorf("unknown wire encoding `%s`", *wireName)
+	}
+
+	tcp, err := transport.Listen(id, *listen, wire)
+	if err != nil {
+		return nil, nil, err
+	}
+	tcp.SetQueue(queue)
+	tcp.SetCompression(transport.Compression{Threshold: cfg.CompressThreshold})
+	if cfg.ClusterSecret != "" {
+		tcp.SetSecret([]byte(cfg.ClusterSecret))
+	} else {
+		log.Print("cluster_secret is not set, messages between nodes are not authenticated")
+	}
+
+	var ids []node.ID
+	for _, p := range strings.Split(*peers, ",") {
+		if p == "" {
+			continue
+		}
+		idStr, addr, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, tcp, fmt.Errorf("invalid peer `%s`, want id=host:port", p)
+		}
+		peerID, err := uuid.Parse(idStr)
+		if err != nil {
+			return nil, tcp, fmt.Errorf("invalid peer id `%s`: %w", idStr, err)
+		}
+		if err := tcp.AddPeer(peerID, addr); err != nil {
+			return nil, tcp, err
+		}
+		ids = append(ids, peerID)
+	}
+
+	r, err := cluster.NewLocal[any](id, ids, tcp, codec, newStore)
+	return r, tcp, err
+}
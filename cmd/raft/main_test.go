@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain lets the test binary stand in for the raft binary, so the tests
+// can start nodes as separate processes without building anything.
+func TestMain(m *testing.M) {
+	if os.Getenv("RAFT_TEST_NODE") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type process struct {
+	id   uuid.UUID
+	raft string
+	http string
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestThreeProcesses(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("codec: json\nrequest_timeout: 5s\ncluster_secret: test secret\ncompress_threshold: 512\n"), 0o600))
+
+	procs := make([]process, 3)
+	for i := range procs {
+		procs[i] = process{id: uuid.New(), raft: freeAddr(t), http: freeAddr(t)}
+	}
+
+	for i, p := range procs {
+		var peers []string
+		for j, q := range procs {
+			if j != i {
+				peers = append(peers, fmt.Sprintf("%s=%s", q.id, q.raft))
+			}
+		}
+
+		cmd := exec.Command(os.Args[0],
+			"-config", config,
+			"-id", p.id.String(),
+			"-listen", p.raft,
+			"-http", p.http,
+			"-peers", strings.Join(peers, ","),
+		)
+		cmd.Env = append(os.Environ(), "RAFT_TEST_NODE=1")
+		require.NoError(t, cmd.Start())
+		t.Cleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+	}
+
+	role := func(p process) string {
+		resp, err := http.Get("http://" + p.http + "/nodes")
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+
+		var nodes struct {
+			Nodes []struct {
+				Role string `json:"role"`
+			} `json:"nodes"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&nodes) != nil || len(nodes.Nodes) != 1 {
+			return ""
+		}
+		return nodes.Nodes[0].Role
+	}
+
+	var leader process
+	require.Eventually(t, func() bool {
+		for _, p := range procs {
+			if role(p) == "Leader" {
+				leader = p
+				return true
+			}
+		}
+		return false
+	}, 30*time.Second, 200*time.Millisecond)
+
+	body := fmt.Sprintf(`{"id": %q, "msg": {"key": "hello", "value": "world"}}`, leader.id)
+	req, err := http.NewRequest(http.MethodGet, "http://"+leader.http+"/request", strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, p := range procs {
+		require.Eventually(t, func() bool {
+			resp, err := http.Get(fmt.Sprintf("http://%s/get?raftNode=%s&key=hello", p.http, p.id))
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+
+			var got struct {
+				Value any `json:"value"`
+			}
+			return resp.StatusCode == http.StatusOK &&
+				json.NewDecoder(resp.Body).Decode(&got) == nil &&
+				got.Value == "world"
+		}, 10*time.Second, 100*time.Millisecond, "node %s did not apply the entry", p.id)
+	}
+}
@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+var (
+	ErrNoNetwork     = errors.New("cluster has no in-memory network")
+	ErrUnknownNode   = errors.New("unknown node")
+	ErrInvalidGroups = errors.New("invalid partition groups")
+)
+
+// Partition splits the cluster into groups: links between nodes of different
+// groups are cut in both directions and links within a group are restored.
+// Nodes not listed in any group form one more group together.
+func (c *Cluster[C, F]) Partition(groups ...[]node.ID) error {
+	if c.Network == nil {
+		return ErrNoNetwork
+	}
+
+	group := make(map[node.ID]int, len(c.Nodes))
+	for i, g := range groups {
+		for _, id := range g {
+			if c.Node(id) == nil {
+				return fmt.Errorf("%w: %v", ErrUnknownNode, id)
+			}
+			if _, ok := group[id]; ok {
+				return fmt.Errorf("%w: node %v is in more than one group", ErrInvalidGroups, id)
+			}
+			group[id] = i
+		}
+	}
+	groupOf := func(id node.ID) int {
+		if i, ok := group[id]; ok {
+			return i
+		}
+		return len(groups)
+	}
+
+	for _, n := range c.Nodes {
+		for _, peer := range n.Peers {
+			if groupOf(n.Id) == groupOf(peer) {
+				n.Connect(peer, node.Both)
+			} else {
+				n.Disconnect(peer, node.Both)
+			}
+		}
+	}
+	return nil
+}
+
+// Heal restores every link of the cluster and clears their faults.
+func (c *Cluster[C, F]) Heal() error {
+	if c.Network == nil {
+		return ErrNoNetwork
+	}
+
+	for _, n := range c.Nodes {
+		for _, peer := range n.Peers {
+			n.Connect(peer, node.Both)
+			n.SetFault(peer, node.Fault{})
+		}
+	}
+	return nil
+}
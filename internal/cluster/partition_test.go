@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+	"github.com/peyuaa/raft/internal/node"
+)
+
+// TestPartitionMinorityLeader cuts the leader off with one follower. The
+// majority elects a new leader and keeps committing, the old leader cannot
+// commit anything, and after healing every node converges on the majority's
+// data.
+func TestPartitionMinorityLeader(t *testing.T) {
+	raft, err := newCluster(5)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+
+	done := make(chan struct{}, 1)
+	go func() {
+		defer func() { done <- struct{}{} }()
+		_ = raft.Run(ctx)
+	}()
+
+	var oldLeader *node.Node
+	require.Eventually(t, func() bool {
+		oldLeader = findLeader(raft)
+		return oldLeader != nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	put := func(n *node.Node, key string) error {
+		waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+		defer waitCancel()
+		_, err := raft.Request(n, raftmap.Command[string, any]{Key: key, Value: n.Id.String()}).Wait(waitCtx)
+		return err
+	}
+
+	applied := func(key string) func() bool {
+		return func() bool {
+			for _, n := range raft.Nodes {
+				if _, ok := raft.FSM(n.Id).Get(key); !ok {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	// the leader has been serving before it is cut off
+	require.NoError(t, put(oldLeader, "before"))
+	require.Eventually(t, applied("before"), 10*time.Second, 100*time.Millisecond)
+
+	var minority, majority []node.ID
+	minority = append(minority, oldLeader.Id)
+	for _, n := range raft.Nodes {
+		switch {
+		case n == oldLeader:
+		case len(minority) < 2:
+			minority = append(minority, n.Id)
+		default:
+			majority = append(majority, n.Id)
+		}
+	}
+	require.NoError(t, raft.Partition(minority, majority))
+	require.False(t, oldLeader.Connected(majority[0], node.Both))
+	require.True(t, oldLeader.Connected(minority[1], node.Both))
+
+	require.Error(t, put(oldLeader, "minority"))
+
+	var newLeader *node.Node
+	require.Eventually(t, func() bool {
+		for _, id := range majority {
+			if n := raft.Node(id); n.GetRole() == node.Leader {
+				newLeader = n
+				return true
+			}
+		}
+		return false
+	}, 20*time.Second, 100*time.Millisecond)
+	require.Greater(t, newLeader.GetTerm(), oldLeader.GetTerm())
+	require.NoError(t, put(newLeader, "majority"))
+
+	require.NoError(t, raft.Heal())
+	require.True(t, oldLeader.Connected(majority[0], node.Both))
+
+	require.Eventually(t, applied("majority"), 20*time.Second, 100*time.Millisecond)
+	for _, n := range raft.Nodes {
+		_, ok := raft.FSM(n.Id).Get("minority")
+		require.False(t, ok, "uncommitted minority write applied on %v", n.Id)
+		_, ok = raft.FSM(n.Id).Get("before")
+		require.True(t, ok)
+	}
+	require.NotEqual(t, node.Leader, oldLeader.GetRole())
+
+	require.ErrorIs(t, raft.Partition([]node.ID{uuid.New()}), ErrUnknownNode)
+	require.ErrorIs(t, raft.Partition(minority, minority), ErrInvalidGroups)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,97 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/queue"
+)
+
+// TestQueueFailover consumes a queue across a leader failover and checks that
+// a message is never delivered again once its ack was applied, while an
+// unacked delivery comes back after its visibility timeout.
+func TestQueueFailover(t *testing.T) {
+	const messages = 10
+
+	raft, err := New[queue.Command](3, journal.JSONCodec{}, queue.New)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+
+	done := make(chan struct{}, 1)
+	go func() {
+		defer func() { done <- struct{}{} }()
+		_ = raft.Run(ctx)
+	}()
+
+	var leader *node.Node
+	require.Eventually(t, func() bool {
+		leader = findLeader(raft)
+		return leader != nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	request := func(cmd queue.Command) (queue.Message, error) {
+		waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+		defer waitCancel()
+
+		cmd.Queue = "jobs"
+		res, err := raft.Request(leader, cmd).Wait(waitCtx)
+		msg, _ := res.Result.(queue.Message)
+		return msg, err
+	}
+
+	for i := range messages {
+		_, err := request(queue.Command{Op: queue.OpEnqueue, Body: json.RawMessage(strconv.Itoa(i))})
+		require.NoError(t, err)
+	}
+
+	acked := make(map[int]bool)
+	consume := func(n int) {
+		for range n {
+			msg, err := request(queue.Command{Op: queue.OpDequeue, Visibility: 2 * time.Second})
+			if errors.Is(err, queue.ErrEmpty) {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			require.False(t, acked[msg.ID], "message %d delivered after ack", msg.ID)
+
+			_, err = request(queue.Command{Op: queue.OpAck, ID: msg.ID, Receipt: msg.Receipt})
+			if err == nil {
+				acked[msg.ID] = true
+			}
+		}
+	}
+
+	consume(messages / 2)
+
+	// leave one delivery unacked and lose the leader
+	_, err = request(queue.Command{Op: queue.OpDequeue, Visibility: 2 * time.Second})
+	require.NoError(t, err)
+
+	first := leader
+	first.TurnOff <- struct{}{}
+	require.Eventually(t, func() bool {
+		leader = findLeader(raft)
+		return leader != nil && leader != first
+	}, 20*time.Second, 100*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		consume(messages)
+		ready, inFlight := raft.FSM(leader.Id).Len("jobs")
+		return ready == 0 && inFlight == 0
+	}, 20*time.Second, time.Second)
+
+	<-first.TurnOff
+	cancel()
+	<-done
+}
@@ -4,39 +4,86 @@ import (
 	"context"
 	"slices"
 
+	"github.com/google/uuid"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/peyuaa/raft/internal/journal"
 	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/transport"
 )
 
-type Cluster struct {
+// Cluster runs nodes that each replicate their own F, the state proposed
+// commands of type C are applied to.
+type Cluster[C any, F any] struct {
 	Nodes []*node.Node
+	// Network is the in-memory transport the nodes talk over.
+	Network *transport.Network
+	fsms    map[node.ID]F
 }
 
-func New(n int) (*Cluster, error) {
-	nodes := make([]*node.Node, n)
-	for i := range n {
-		nodes[i] = node.NewNode(slices.Values(nodes[:i]))
-		for _, nd := range nodes[:i] {
-			if err := nd.Add(nodes[i]); err != nil {
-				return nil, err
-			}
+// New creates a cluster of n nodes, each applying entries to its own typed
+// FSM.
+func New[C any, F journal.FSM[C]](n int, codec journal.Codec, newFSM func() F) (*Cluster[C, F], error) {
+	return NewWith[C](n, codec, func() (F, journal.Processor, error) {
+		fsm := newFSM()
+		return fsm, journal.Machine[C](fsm), nil
+	})
+}
+
+// NewWith creates a cluster of n nodes whose entries are applied to the
+// processor returned alongside each F, such as a journal.Registry.
+func NewWith[C any, F any](n int, codec journal.Codec, newState func() (F, journal.Processor, error)) (*Cluster[C, F], error) {
+	c := &Cluster[C, F]{
+		Nodes:   make([]*node.Node, n),
+		Network: transport.NewNetwork(),
+		fsms:    make(map[node.ID]F, n),
+	}
+	ids := make([]node.ID, n)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	for i, id := range ids {
+		fsm, processor, err := newState()
+		if err != nil {
+			return nil, err
 		}
+		peers := slices.Concat(ids[:i], ids[i+1:])
+		c.Nodes[i] = node.NewNode(id, slices.Values(peers), c.Network.Join(id), processor, codec)
+		c.fsms[id] = fsm
+	}
+	return c, nil
+}
+
+// NewLocal creates a cluster handle for one node whose peers run elsewhere and
+// are reached through t. Network is nil for such a cluster.
+func NewLocal[C any, F any](id node.ID, peers []node.ID, t node.Transport, codec journal.Codec, newState func() (F, journal.Processor, error)) (*Cluster[C, F], error) {
+	fsm, processor, err := newState()
+	if err != nil {
+		return nil, err
 	}
-	return &Cluster{nodes}, nil
+	n := node.NewNode(id, slices.Values(peers), t, processor, codec)
+	return &Cluster[C, F]{
+		Nodes: []*node.Node{n},
+		fsms:  map[node.ID]F{id: fsm},
+	}, nil
 }
 
-func (c *Cluster) Run(ctx context.Context) error {
+// Run runs every node until ctx is done, then closes the in-memory network.
+func (c *Cluster[C, F]) Run(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 	for _, n := range c.Nodes {
 		g.Go(func() error {
 			return n.Run(ctx)
 		})
 	}
-	return g.Wait()
+	err := g.Wait()
+	if c.Network != nil {
+		c.Network.Close()
+	}
+	return err
 }
 
-func (c *Cluster) Node(id node.ID) *node.Node {
+func (c *Cluster[C, F]) Node(id node.ID) *node.Node {
 	for _, n := range c.Nodes {
 		if n.Id == id {
 			return n
@@ -44,3 +91,14 @@ func (c *Cluster) Node(id node.ID) *node.Node {
 	}
 	return nil
 }
+
+// FSM returns the state machine replica of the node with the given id.
+func (c *Cluster[C, F]) FSM(id node.ID) F {
+	return c.fsms[id]
+}
+
+// Request proposes a command through n. The single machine of the cluster's
+// nodes is unnamed, and C is the type of its commands.
+func (c *Cluster[C, F]) Request(n *node.Node, cmd C) *node.Future {
+	return node.RequestTo(n, journal.Name[C](""), cmd)
+}
@@ -7,11 +7,13 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/peyuaa/raft/internal/journal"
+	raftmap "github.com/peyuaa/raft/internal/map"
 	"github.com/peyuaa/raft/internal/node"
 )
 
 func TestRaft(t *testing.T) {
-	raft, err := New(3)
+	raft, err := newCluster(3)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -45,13 +47,13 @@ func TestRaft(t *testing.T) {
 	t.Log(secondLeader.Id)
 
 	require.NotEqual(t, firstLeader.Id, secondLeader.Id)
-	require.NotEqual(t, firstLeader.Term, secondLeader.Term)
+	require.NotEqual(t, firstLeader.GetTerm(), secondLeader.GetTerm())
 
 	// turn on first leader
 	<-firstLeader.TurnOff
 
 	require.Eventually(t, func() bool {
-		return firstLeader.Term == secondLeader.Term
+		return firstLeader.GetTerm() == secondLeader.GetTerm()
 	}, 2*time.Second, 100*time.Millisecond)
 
 	cancel()
@@ -59,7 +61,7 @@ func TestRaft(t *testing.T) {
 }
 
 func TestLog(t *testing.T) {
-	raft, err := New(5)
+	raft, err := newCluster(5)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -79,7 +81,7 @@ func TestLog(t *testing.T) {
 		return leader != nil
 	}, 5*time.Second, 100*time.Millisecond)
 	t.Log("put aboba")
-	leader.Request("aboba")
+	raft.Request(leader, raftmap.Command[string, any]{Key: "aboba"})
 	first := leader
 	time.Sleep(3 * time.Second)
 	leader.TurnOff <- struct{}{}
@@ -88,7 +90,7 @@ func TestLog(t *testing.T) {
 		leader = findLeader(raft)
 		return leader != nil
 	}, 5*time.Second, 100*time.Millisecond)
-	leader.Request("aboba2")
+	raft.Request(leader, raftmap.Command[string, any]{Key: "aboba2"})
 	time.Sleep(3 * time.Second)
 	<-first.TurnOff
 	time.Sleep(3 * time.Second)
@@ -100,13 +102,69 @@ func TestLog(t *testing.T) {
 	<-done
 }
 
-func findLeader(raft *Cluster) (n *node.Node) {
+type testCluster = Cluster[raftmap.Command[string, any], *raftmap.Map[string, any]]
+
+func newCluster(n int) (*testCluster, error) {
+	return New[raftmap.Command[string, any]](n, journal.JSONCodec{}, raftmap.New[string, any])
+}
+
+func findLeader[C, F any](raft *Cluster[C, F]) (n *node.Node) {
 	maxTerm := -2
 	for _, raftNode := range raft.Nodes {
-		if raftNode.Role == node.Leader && raftNode.Term > maxTerm {
+		if raftNode.GetRole() == node.Leader && raftNode.GetTerm() > maxTerm {
 			n = raftNode
-			maxTerm = raftNode.Term
+			maxTerm = raftNode.GetTerm()
 		}
 	}
 	return
 }
+
+func TestRequestResult(t *testing.T) {
+	raft, err := newCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	done := make(chan struct{}, 1)
+	go func() {
+		defer func() { done <- struct{}{} }()
+		_ = raft.Run(ctx)
+	}()
+
+	var leader *node.Node
+	require.Eventually(t, func() bool {
+		leader = findLeader(raft)
+		return leader != nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer waitCancel()
+
+	res, err := raft.Request(leader, raftmap.Command[string, any]{Key: "hello", Value: "world"}).Wait(waitCtx)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, res.Index, 0)
+
+	v, ok := raft.FSM(leader.Id).Get("hello")
+	require.True(t, ok)
+	require.Equal(t, "world", v)
+
+	// a follower forwards the request to the leader over the transport
+	var follower *node.Node
+	for _, raftNode := range raft.Nodes {
+		if raftNode != leader {
+			follower = raftNode
+			break
+		}
+	}
+	res, err = raft.Request(follower, raftmap.Command[string, any]{Key: "via", Value: "follower"}).Wait(waitCtx)
+	require.NoError(t, err)
+
+	v, ok = raft.FSM(follower.Id).Get("via")
+	require.True(t, ok)
+	require.Equal(t, "follower", v)
+
+	cancel()
+	<-done
+}
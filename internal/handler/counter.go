@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+)
+
+type counterRequest struct {
+	Key   string `json:"key"`
+	Delta int64  `json:"delta"`
+	Min   *int64 `json:"min"`
+	Max   *int64 `json:"max"`
+	TTL   string `json:"ttl"`
+	Store string `json:"store"`
+	ID    string `json:"id"`
+}
+
+// Increment adds delta to an integer key and returns the new value.
+func (h *Handler) Increment(w http.ResponseWriter, r *http.Request) {
+	h.counterCommand(w, r, raftmap.OpIncrement)
+}
+
+// Decrement subtracts delta from an integer key and returns the new value.
+func (h *Handler) Decrement(w http.ResponseWriter, r *http.Request) {
+	h.counterCommand(w, r, raftmap.OpDecrement)
+}
+
+func (h *Handler) counterCommand(w http.ResponseWriter, r *http.Request, op raftmap.Op) {
+	req := counterRequest{Delta: 1}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raftNode, ok := h.nodeFromBody(w, req.ID)
+	if !ok {
+		return
+	}
+
+	if req.Key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+
+	name, _, ok := h.mapStore(w, raftNode, req.Store)
+	if !ok {
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cmd := raftmap.Command[string, any]{
+		Op:    op,
+		Key:   req.Key,
+		Delta: req.Delta,
+		Min:   req.Min,
+		Max:   req.Max,
+		TTL:   ttl,
+	}
+
+	applied, ok := propose(h, w, r, raftNode, name, cmd)
+	if !ok {
+		return
+	}
+
+	result, _ := applied.Result.(raftmap.Result[any])
+
+	res := CounterResponse{
+		Id:    req.ID,
+		Index: applied.Index,
+		Key:   req.Key,
+		Value: result.Value,
+	}
+
+	writeJSON(w, res)
+}
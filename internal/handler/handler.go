@@ -1,22 +1,39 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/peyuaa/raft/internal/cluster"
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/lock"
+	raftmap "github.com/peyuaa/raft/internal/map"
 	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/queue"
+	"github.com/peyuaa/raft/internal/store"
 )
 
+// Cluster is the cluster served over HTTP: every node replicates a
+// store.Store and commands are routed to one of its machines by name. The
+// store has no single command type, so requests are typed per machine by
+// their journal.Name instead of by the cluster.
+type Cluster = cluster.Cluster[any, *store.Store]
+
 type Handler struct {
-	raft *cluster.Cluster
+	raft    *Cluster
+	timeout time.Duration
 }
 
-func New(raft *cluster.Cluster) *Handler {
-	return &Handler{raft}
+// New creates a handler. Client requests wait up to timeout for their entry
+// to be applied.
+func New(raft *Cluster, timeout time.Duration) *Handler {
+	return &Handler{raft: raft, timeout: timeout}
 }
 
 func (h *Handler) Nodes(w http.ResponseWriter, _ *http.Request) {
@@ -25,13 +42,28 @@ func (h *Handler) Nodes(w http.ResponseWriter, _ *http.Request) {
 	}
 
 	for _, n := range h.raft.Nodes {
-		response.Nodes = append(response.Nodes, NodeResponse{
+		res := NodeResponse{
 			Id:         n.Id.String(),
-			Role:       n.Role.String(),
-			Term:       n.Term,
+			Role:       n.GetRole().String(),
+			Term:       n.GetTerm(),
 			JournalLen: n.Journal.Len(),
 			Alive:      !n.TurnOffBool,
-		})
+			Rejected:   n.Rejected(),
+		}
+		stats := n.SendStats()
+		for _, peer := range n.Peers {
+			s, ok := stats[peer]
+			if !ok {
+				continue
+			}
+			res.SendQueues = append(res.SendQueues, SendQueueResponse{
+				Peer:    peer.String(),
+				Queued:  s.Queued,
+				Dropped: s.Dropped,
+				Pending: s.Pending,
+			})
+		}
+		response.Nodes = append(response.Nodes, res)
 	}
 
 	res, err := json.Marshal(response)
@@ -48,54 +80,144 @@ func (h *Handler) Nodes(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (h *Handler) Journal(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("raftNode")
-	if id == "" {
-		http.Error(w, "raftNode id is required", http.StatusBadRequest)
+	raftNode, ok := h.nodeFromQuery(w, r)
+	if !ok {
 		return
 	}
 
-	uid, err := uuid.Parse(id)
+	from, err := intQuery(r, "from", 0)
 	if err != nil {
-		http.Error(w, "invalid raftNode id", http.StatusBadRequest)
+		http.Error(w, "invalid from index", http.StatusBadRequest)
 		return
 	}
 
-	raftNode := h.raft.Node(node.ID(uid))
-	if raftNode == nil {
-		http.Error(w, "raftNode not found", http.StatusNotFound)
+	to, err := intQuery(r, "to", -1)
+	if err != nil {
+		http.Error(w, "invalid to index", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "ndjson" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		enc := json.NewEncoder(w)
+		for entry := range raftNode.Journal.Range(from, to) {
+			if err := enc.Encode(journalEntry(raftNode, entry)); err != nil {
+				return
+			}
+		}
 		return
 	}
 
 	res := JournalResponse{
-		Id:  raftNode.Id.String(),
-		Log: make([]string, 0, raftNode.Journal.Len()),
+		Id:      raftNode.Id.String(),
+		Entries: []JournalEntry{},
 	}
 
-	for entry := range raftNode.Journal.Entries() {
-		res.Log = append(res.Log, entry.String())
+	for entry := range raftNode.Journal.Range(from, to) {
+		res.Entries = append(res.Entries, journalEntry(raftNode, entry))
 	}
 
-	body, err := json.Marshal(res)
+	writeJSON(w, res)
+}
+
+func journalEntry(raftNode *node.Node, entry journal.Message) JournalEntry {
+	res := JournalEntry{
+		Index:     entry.Index,
+		Term:      entry.Term,
+		Committed: raftNode.Journal.Committed(entry.Index),
+		Applied:   raftNode.Journal.Applied(entry.Index),
+		Type:      entry.Type,
+		Data:      entryData(entry.Command),
+	}
+	if err := raftNode.Journal.ApplyError(entry.Index); err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// entryData keeps JSON payloads and ticks readable in the export; other
+// encodings are returned as raw bytes.
+func entryData(cmd journal.Command) any {
+	if now, ok := cmd.Tick(); ok {
+		return now
+	}
+	if cmd.Type == (journal.JSONCodec{}).Name() && json.Valid(cmd.Data) {
+		return json.RawMessage(cmd.Data)
+	}
+	return cmd.Data
+}
+
+type compactRequest struct {
+	Revision int    `json:"revision"`
+	Store    string `json:"store"`
+	ID       string `json:"id"`
+}
+
+// Compact drops the key history older than the given revision on every node.
+func (h *Handler) Compact(w http.ResponseWriter, r *http.Request) {
+	var req compactRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	raftNode, ok := h.nodeFromBody(w, req.ID)
+	if !ok {
+		return
+	}
 
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	name, _, ok := h.mapStore(w, raftNode, req.Store)
+	if !ok {
 		return
 	}
+
+	applied, ok := propose(h, w, r, raftNode, name, raftmap.Command[string, any]{Op: raftmap.OpCompact, Revision: req.Revision})
+	if !ok {
+		return
+	}
+
+	res := CompactResponse{
+		Id:       req.ID,
+		Index:    applied.Index,
+		Revision: req.Revision,
+	}
+
+	writeJSON(w, res)
 }
 
 type request struct {
-	Msg map[string]any `json:"msg"`
-	ID  string         `json:"id"`
+	Msg   requestMsg `json:"msg"`
+	Store string     `json:"store"`
+	ID    string     `json:"id"`
+}
+
+// requestMsg values are kept as decoded, so numbers stay numbers in /get.
+type requestMsg struct {
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Expected any    `json:"expected"`
+	TTL      string `json:"ttl"`
 }
 
 func (h *Handler) Request(w http.ResponseWriter, r *http.Request) {
+	h.mapCommand(w, r, raftmap.OpPut)
+}
+
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	h.mapCommand(w, r, raftmap.OpDelete)
+}
+
+func (h *Handler) PutIfAbsent(w http.ResponseWriter, r *http.Request) {
+	h.mapCommand(w, r, raftmap.OpPutIfAbsent)
+}
+
+func (h *Handler) CompareAndSwap(w http.ResponseWriter, r *http.Request) {
+	h.mapCommand(w, r, raftmap.OpCAS)
+}
+
+func (h *Handler) mapCommand(w http.ResponseWriter, r *http.Request, op raftmap.Op) {
 	var req request
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -103,37 +225,83 @@ func (h *Handler) Request(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uid, err := uuid.Parse(req.ID)
-	if err != nil {
-		http.Error(w, "invalid raftNode id", http.StatusBadRequest)
+	raftNode, ok := h.nodeFromBody(w, req.ID)
+	if !ok {
 		return
 	}
 
-	raftNode := h.raft.Node(node.ID(uid))
-	if raftNode == nil {
-		http.Error(w, "raftNode not found", http.StatusNotFound)
+	if req.Msg.Key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
 		return
 	}
 
-	raftNode.Request(req.Msg)
+	name, _, ok := h.mapStore(w, raftNode, req.Store)
+	if !ok {
+		return
+	}
 
-	res := RequestResponse{
-		Id:    req.ID,
-		Key:   req.Msg["key"].(string),
-		Value: req.Msg["value"].(string),
+	var ttl time.Duration
+	if req.Msg.TTL != "" {
+		ttl, err = time.ParseDuration(req.Msg.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
 	}
 
-	body, err := json.Marshal(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	cmd := raftmap.Command[string, any]{
+		Op:       op,
+		Key:      req.Msg.Key,
+		Value:    req.Msg.Value,
+		Expected: req.Msg.Expected,
+		TTL:      ttl,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	applied, ok := propose(h, w, r, raftNode, name, cmd)
+	if !ok {
+		return
+	}
 
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	res := RequestResponse{
+		Id:     req.ID,
+		Op:     string(op),
+		Key:    req.Msg.Key,
+		Value:  req.Msg.Value,
+		Index:  applied.Index,
+		Result: applied.Result,
 	}
+
+	writeJSON(w, res)
+}
+
+// propose submits cmd to the named machine through raftNode and waits for it
+// to be applied. On failure it writes the error response itself and returns
+// false.
+func propose[C any](h *Handler, w http.ResponseWriter, r *http.Request, raftNode *node.Node, machine journal.Name[C], cmd C) (journal.ApplyResult, bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	res, err := node.RequestTo(raftNode, machine, cmd).Wait(ctx)
+	switch {
+	case err == nil:
+		return res, true
+	case errors.Is(err, node.ErrTimeout):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	case errors.Is(err, node.ErrNotLeader), errors.Is(err, node.ErrLostLeadership), errors.Is(err, node.ErrBusy):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, journal.ErrInvalidCommand), errors.Is(err, raftmap.ErrInvalidRequest),
+		errors.Is(err, lock.ErrInvalidRequest), errors.Is(err, queue.ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, raftmap.ErrKeyNotFound), errors.Is(err, queue.ErrEmpty):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, raftmap.ErrKeyExists), errors.Is(err, raftmap.ErrCompareFailed),
+		errors.Is(err, raftmap.ErrNotNumber), errors.Is(err, raftmap.ErrOverflow), errors.Is(err, raftmap.ErrOutOfRange),
+		errors.Is(err, lock.ErrHeld), errors.Is(err, lock.ErrNotHolder), errors.Is(err, queue.ErrNotInFlight):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	}
+	return res, false
 }
 
 func (h *Handler) Kill(w http.ResponseWriter, r *http.Request) {
@@ -201,24 +369,17 @@ func (h *Handler) DumpMap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := DumpResponse{
-		Id:   raftNode.Id.String(),
-		Dump: fmt.Sprint(raftNode.Journal.Proc().Dump()),
-	}
-
-	body, err := json.Marshal(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	_, m, ok := h.mapStore(w, raftNode, r.URL.Query().Get("store"))
+	if !ok {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	res := DumpResponse{
+		Id:   raftNode.Id.String(),
+		Dump: fmt.Sprint(m.Dump()),
 	}
+
+	writeJSON(w, res)
 }
 
 func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
@@ -242,31 +403,39 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 
 	key := r.URL.Query().Get("key")
 
-	v, ok := raftNode.Journal.Proc().Get(key)
-	if !ok {
-		http.Error(w, "key not found", http.StatusNotFound)
+	rev, err := intQuery(r, "rev", -1)
+	if err != nil {
+		http.Error(w, "invalid rev", http.StatusBadRequest)
 		return
 	}
 
-	res := GetResponse{
-		Id:    id,
-		Key:   key,
-		Value: v.(string),
+	_, m, ok := h.mapStore(w, raftNode, r.URL.Query().Get("store"))
+	if !ok {
+		return
 	}
 
-	body, err := json.Marshal(res)
+	v, wrote, err := m.GetAt(key, rev)
+	if errors.Is(err, raftmap.ErrCompacted) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "key not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	res := GetResponse{
+		Id:       id,
+		Key:      key,
+		Value:    v,
+		Revision: wrote,
+	}
 
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if ttl, ok := m.TTL(key); ok && rev < 0 {
+		res.TTL = ttl.String()
 	}
+
+	writeJSON(w, res)
 }
 
 func (h *Handler) Topology(w http.ResponseWriter, r *http.Request) {
@@ -290,29 +459,24 @@ func (h *Handler) Topology(w http.ResponseWriter, r *http.Request) {
 
 	res := TopologyResponse{
 		Id:    id,
-		Nodes: make([]NodesStatus, 0, len(raftNode.HasConnects)),
+		Nodes: make([]NodesStatus, 0, len(raftNode.Peers)),
 	}
 
-	for nd, b := range raftNode.HasConnects {
-		res.Nodes = append(res.Nodes, NodesStatus{
-			Node:      nd.String(),
-			Connected: b,
-		})
+	for _, peer := range raftNode.Peers {
+		status := NodesStatus{
+			Node:      peer.String(),
+			Connected: raftNode.Connected(peer, node.Both),
+			Outbound:  raftNode.Connected(peer, node.Outbound),
+			Inbound:   raftNode.Connected(peer, node.Inbound),
+		}
+		if f := raftNode.Fault(peer); f != (node.Fault{}) {
+			lf := linkFault(f)
+			status.Fault = &lf
+		}
+		res.Nodes = append(res.Nodes, status)
 	}
 
-	body, err := json.Marshal(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	writeJSON(w, res)
 }
 
 func (h *Handler) Disconnect(w http.ResponseWriter, r *http.Request) {
@@ -346,27 +510,22 @@ func (h *Handler) Disconnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b := raftNode.Disconnect(uidWith)
-
-	res := DisconnectResponse{
-		Node:   id,
-		With:   idWith,
-		Status: b,
-	}
-
-	body, err := json.Marshal(res)
+	dir, err := directionQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	b := raftNode.Disconnect(uidWith, dir)
 
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	res := DisconnectResponse{
+		Node:      id,
+		With:      idWith,
+		Direction: dir.String(),
+		Status:    b,
 	}
+
+	writeJSON(w, res)
 }
 
 func (h *Handler) Connect(w http.ResponseWriter, r *http.Request) {
@@ -400,25 +559,20 @@ func (h *Handler) Connect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	status := raftNode.Connect(uidWith)
-
-	res := ConnectResponse{
-		Node:   id,
-		With:   idWith,
-		Status: status,
-	}
-
-	body, err := json.Marshal(res)
+	dir, err := directionQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	status := raftNode.Connect(uidWith, dir)
 
-	_, err = w.Write(body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	res := ConnectResponse{
+		Node:      id,
+		With:      idWith,
+		Direction: dir.String(),
+		Status:    status,
 	}
+
+	writeJSON(w, res)
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/cluster"
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/store"
+)
+
+func newStoreCluster(t *testing.T) *Cluster {
+	raft, err := cluster.NewWith[any](3, journal.JSONCodec{}, func() (*store.Store, journal.Processor, error) {
+		s, err := store.New()
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.Registry(), nil
+	})
+	require.NoError(t, err)
+	return raft
+}
+
+func serve(handle http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handle(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return w
+}
+
+// TestProposeStatus checks that the errors of a proposal reach the client as
+// the status codes documented in the README.
+func TestProposeStatus(t *testing.T) {
+	raft := newStoreCluster(t)
+	h := New(raft, 5*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	done := make(chan struct{}, 1)
+	go func() {
+		defer func() { done <- struct{}{} }()
+		_ = raft.Run(ctx)
+	}()
+
+	var leader *node.Node
+	require.Eventually(t, func() bool {
+		for _, n := range raft.Nodes {
+			if n.GetRole() == node.Leader {
+				leader = n
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 100*time.Millisecond)
+	id := leader.Id.String()
+
+	for _, tt := range []struct {
+		name   string
+		handle http.HandlerFunc
+		body   string
+		status int
+	}{
+		{"put", h.Request, `{"msg": {"key": "a", "value": "x"}}`, http.StatusOK},
+		{"put if absent", h.PutIfAbsent, `{"msg": {"key": "a", "value": "y"}}`, http.StatusConflict},
+		{"cas mismatch", h.CompareAndSwap, `{"msg": {"key": "a", "value": "y", "expected": "z"}}`, http.StatusConflict},
+		{"delete missing", h.Delete, `{"msg": {"key": "b"}}`, http.StatusNotFound},
+		{"incr string", h.Increment, `{"key": "a", "delta": 1}`, http.StatusConflict},
+		{"unknown store", h.Request, `{"msg": {"key": "a"}, "store": "other"}`, http.StatusNotFound},
+		{"acquire", h.LockAcquire, `{"name": "l", "owner": "o1", "lease": "1m"}`, http.StatusOK},
+		{"acquire held", h.LockAcquire, `{"name": "l", "owner": "o2", "lease": "1m"}`, http.StatusConflict},
+		{"release stale", h.LockRelease, `{"name": "l", "owner": "o1", "token": 42}`, http.StatusConflict},
+		{"dequeue empty", h.Dequeue, `{"queue": "q", "visibility": "1m"}`, http.StatusNotFound},
+		{"ack not in flight", h.Ack, `{"queue": "q", "message": 1, "receipt": 1}`, http.StatusConflict},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Replace(tt.body, "{", fmt.Sprintf(`{"id": "%s", `, id), 1)
+			w := serve(tt.handle, body)
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+
+	cancel()
+	<-done
+}
+
+// TestProposeUnavailable proposes to nodes that are not running, so nothing
+// is ever applied.
+func TestProposeUnavailable(t *testing.T) {
+	raft := newStoreCluster(t)
+
+	raft.Nodes[0].SetRole(node.Candidate)
+	w := serve(New(raft, time.Second).Request, fmt.Sprintf(`{"id": "%s", "msg": {"key": "a"}}`, raft.Nodes[0].Id))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+
+	raft.Nodes[1].SetRole(node.Leader)
+	w = serve(New(raft, 10*time.Millisecond).Request, fmt.Sprintf(`{"id": "%s", "msg": {"key": "a"}}`, raft.Nodes[1].Id))
+	require.Equal(t, http.StatusGatewayTimeout, w.Code, w.Body.String())
+
+	w = serve(New(raft, time.Second).Request, `{"id": "nope", "msg": {"key": "a"}}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(New(raft, time.Second).Request, fmt.Sprintf(`{"id": "%s", "msg": {"key": "a"}}`, uuid.New()))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+// Link sets the fault policy of the link between two nodes. Parameters that
+// are not given are healthy, so a bare /link restores the link.
+func (h *Handler) Link(w http.ResponseWriter, r *http.Request) {
+	raftNode, ok := h.nodeFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	idWith := r.URL.Query().Get("with")
+	if idWith == "" {
+		http.Error(w, "raftNode id is required", http.StatusBadRequest)
+		return
+	}
+
+	uidWith, err := uuid.Parse(idWith)
+	if err != nil {
+		http.Error(w, "invalid raftNode id", http.StatusBadRequest)
+		return
+	}
+
+	var f node.Fault
+	for name, p := range map[string]*float64{"drop": &f.Drop, "duplicate": &f.Duplicate} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		*p, err = strconv.ParseFloat(v, 64)
+		if err != nil || *p < 0 || *p > 1 {
+			http.Error(w, "invalid "+name+", want a probability in [0, 1]", http.StatusBadRequest)
+			return
+		}
+	}
+	for name, p := range map[string]*time.Duration{"delay": &f.Delay, "jitter": &f.Jitter, "reorder": &f.Reorder} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		*p, err = time.ParseDuration(v)
+		if err != nil || *p < 0 {
+			http.Error(w, "invalid "+name, http.StatusBadRequest)
+			return
+		}
+	}
+
+	res := LinkResponse{
+		Node:   raftNode.Id.String(),
+		With:   idWith,
+		Status: raftNode.SetFault(uidWith, f),
+		Fault:  linkFault(f),
+	}
+
+	writeJSON(w, res)
+}
+
+func linkFault(f node.Fault) LinkFault {
+	return LinkFault{
+		Drop:      f.Drop,
+		Duplicate: f.Duplicate,
+		Delay:     f.Delay.String(),
+		Jitter:    f.Jitter.String(),
+		Reorder:   f.Reorder.String(),
+	}
+}
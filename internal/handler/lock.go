@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/peyuaa/raft/internal/lock"
+	"github.com/peyuaa/raft/internal/store"
+)
+
+type lockRequest struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Lease string `json:"lease"`
+	Token int    `json:"token"`
+	ID    string `json:"id"`
+}
+
+// LockAcquire grants a lock with a lease. The returned token must be passed
+// to renew and release and can be used to fence writes by stale holders.
+func (h *Handler) LockAcquire(w http.ResponseWriter, r *http.Request) {
+	h.lockCommand(w, r, lock.OpAcquire)
+}
+
+func (h *Handler) LockRenew(w http.ResponseWriter, r *http.Request) {
+	h.lockCommand(w, r, lock.OpRenew)
+}
+
+func (h *Handler) LockRelease(w http.ResponseWriter, r *http.Request) {
+	h.lockCommand(w, r, lock.OpRelease)
+}
+
+func (h *Handler) lockCommand(w http.ResponseWriter, r *http.Request, op lock.Op) {
+	var req lockRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raftNode, ok := h.nodeFromBody(w, req.ID)
+	if !ok {
+		return
+	}
+
+	if req.Name == "" || req.Owner == "" {
+		http.Error(w, "name and owner are required", http.StatusBadRequest)
+		return
+	}
+
+	var lease time.Duration
+	if op != lock.OpRelease {
+		lease, err = time.ParseDuration(req.Lease)
+		if err != nil || lease <= 0 {
+			http.Error(w, "invalid lease", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cmd := lock.Command{
+		Op:    op,
+		Name:  req.Name,
+		Owner: req.Owner,
+		Lease: lease,
+		Token: req.Token,
+	}
+
+	applied, ok := propose(h, w, r, raftNode, store.Locks, cmd)
+	if !ok {
+		return
+	}
+
+	result, _ := applied.Result.(lock.Result)
+
+	res := LockResponse{
+		Id:    req.ID,
+		Index: applied.Index,
+		Name:  req.Name,
+		Owner: result.Owner,
+		Token: result.Token,
+	}
+	if result.TTL > 0 {
+		res.TTL = result.TTL.String()
+	}
+
+	writeJSON(w, res)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/peyuaa/raft/internal/cluster"
+	"github.com/peyuaa/raft/internal/node"
+)
+
+// Partition splits the cluster into the groups given as repeated group
+// parameters of comma-separated node ids. Nodes left out form one more group.
+func (h *Handler) Partition(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()["group"]
+	if len(params) == 0 {
+		http.Error(w, "at least one group is required", http.StatusBadRequest)
+		return
+	}
+
+	groups := make([][]node.ID, 0, len(params))
+	for _, p := range params {
+		var group []node.ID
+		for _, id := range strings.Split(p, ",") {
+			uid, err := uuid.Parse(id)
+			if err != nil {
+				http.Error(w, "invalid raftNode id", http.StatusBadRequest)
+				return
+			}
+			group = append(group, uid)
+		}
+		groups = append(groups, group)
+	}
+
+	err := h.raft.Partition(groups...)
+	switch {
+	case errors.Is(err, cluster.ErrUnknownNode):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, cluster.ErrInvalidGroups):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	h.writePartition(w, groups)
+}
+
+// Heal restores every link of the cluster and clears their faults.
+func (h *Handler) Heal(w http.ResponseWriter, _ *http.Request) {
+	if err := h.raft.Heal(); err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	all := make([]node.ID, 0, len(h.raft.Nodes))
+	for _, n := range h.raft.Nodes {
+		all = append(all, n.Id)
+	}
+	h.writePartition(w, [][]node.ID{all})
+}
+
+func (h *Handler) writePartition(w http.ResponseWriter, groups [][]node.ID) {
+	res := PartitionResponse{Groups: make([][]string, 0, len(groups))}
+	for _, group := range groups {
+		ids := make([]string, 0, len(group))
+		for _, id := range group {
+			ids = append(ids, id.String())
+		}
+		res.Groups = append(res.Groups, ids)
+	}
+
+	writeJSON(w, res)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"github.com/peyuaa/raft/internal/journal"
+	raftmap "github.com/peyuaa/raft/internal/map"
+	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/store"
+)
+
+// nodeFromQuery resolves the raftNode query parameter. On failure it writes
+// the error response itself and returns false.
+func (h *Handler) nodeFromQuery(w http.ResponseWriter, r *http.Request) (*node.Node, bool) {
+	id := r.URL.Query().Get("raftNode")
+	if id == "" {
+		http.Error(w, "raftNode id is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "invalid raftNode id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	raftNode := h.raft.Node(node.ID(uid))
+	if raftNode == nil {
+		http.Error(w, "raftNode not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return raftNode, true
+}
+
+// nodeFromBody resolves the raftNode id carried in a request body. On failure
+// it writes the error response itself and returns false.
+func (h *Handler) nodeFromBody(w http.ResponseWriter, id string) (*node.Node, bool) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "invalid raftNode id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	raftNode := h.raft.Node(node.ID(uid))
+	if raftNode == nil {
+		http.Error(w, "raftNode not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return raftNode, true
+}
+
+// writeJSON writes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// the status line is already sent, so a failed write cannot be reported
+	_, _ = w.Write(body)
+}
+
+// mapStore resolves the named map of raftNode, the default map if name is
+// empty. On failure it writes the error response itself and returns false.
+func (h *Handler) mapStore(w http.ResponseWriter, raftNode *node.Node, name string) (journal.Name[store.MapCommand], *raftmap.Map[string, any], bool) {
+	if name == "" {
+		name = store.Default
+	}
+
+	m, ok := h.raft.FSM(raftNode.Id).Map(name)
+	if !ok {
+		http.Error(w, "store not found", http.StatusNotFound)
+		return "", nil, false
+	}
+
+	return store.MapName(name), m, true
+}
+
+// directionQuery parses the direction query parameter, Both if it is absent.
+func directionQuery(r *http.Request) (node.Direction, error) {
+	switch v := r.URL.Query().Get("direction"); v {
+	case "", "both":
+		return node.Both, nil
+	case "outbound":
+		return node.Outbound, nil
+	case "inbound":
+		return node.Inbound, nil
+	default:
+		return node.Both, fmt.Errorf("invalid direction `%s`, want both, outbound or inbound", v)
+	}
+}
+
+func intQuery(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/peyuaa/raft/internal/queue"
+	"github.com/peyuaa/raft/internal/store"
+)
+
+type queueRequest struct {
+	Queue      string          `json:"queue"`
+	Body       json.RawMessage `json:"body"`
+	Visibility string          `json:"visibility"`
+	Message    int             `json:"message"`
+	Receipt    int             `json:"receipt"`
+	ID         string          `json:"id"`
+}
+
+func (h *Handler) Enqueue(w http.ResponseWriter, r *http.Request) {
+	h.queueCommand(w, r, queue.OpEnqueue)
+}
+
+// Dequeue delivers the oldest visible message and hides it for the requested
+// visibility timeout. Ack or nack it with the returned message and receipt.
+func (h *Handler) Dequeue(w http.ResponseWriter, r *http.Request) {
+	h.queueCommand(w, r, queue.OpDequeue)
+}
+
+func (h *Handler) Ack(w http.ResponseWriter, r *http.Request) {
+	h.queueCommand(w, r, queue.OpAck)
+}
+
+func (h *Handler) Nack(w http.ResponseWriter, r *http.Request) {
+	h.queueCommand(w, r, queue.OpNack)
+}
+
+func (h *Handler) queueCommand(w http.ResponseWriter, r *http.Request, op queue.Op) {
+	var req queueRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raftNode, ok := h.nodeFromBody(w, req.ID)
+	if !ok {
+		return
+	}
+
+	if req.Queue == "" {
+		http.Error(w, "queue is required", http.StatusBadRequest)
+		return
+	}
+
+	cmd := queue.Command{
+		Op:      op,
+		Queue:   req.Queue,
+		ID:      req.Message,
+		Receipt: req.Receipt,
+	}
+
+	switch op {
+	case queue.OpEnqueue:
+		if len(req.Body) == 0 {
+			http.Error(w, "body is required", http.StatusBadRequest)
+			return
+		}
+		cmd.Body = req.Body
+	case queue.OpDequeue:
+		cmd.Visibility, err = time.ParseDuration(req.Visibility)
+		if err != nil || cmd.Visibility <= 0 {
+			http.Error(w, "invalid visibility", http.StatusBadRequest)
+			return
+		}
+	}
+
+	applied, ok := propose(h, w, r, raftNode, store.Queues, cmd)
+	if !ok {
+		return
+	}
+
+	msg, _ := applied.Result.(queue.Message)
+
+	res := QueueResponse{
+		Id:         req.ID,
+		Index:      applied.Index,
+		Queue:      req.Queue,
+		Message:    msg.ID,
+		Body:       msg.Body,
+		Deliveries: msg.Deliveries,
+		Receipt:    msg.Receipt,
+	}
+
+	writeJSON(w, res)
+}
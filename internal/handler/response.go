@@ -1,26 +1,94 @@
 package handler
 
+import (
+	"encoding/json"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+)
+
 type NodeResponse struct {
-	Id         string `json:"id"`
-	Role       string `json:"role"`
-	Term       int    `json:"term"`
-	JournalLen int    `json:"journal_len"`
-	Alive      bool   `json:"alive"`
+	Id         string              `json:"id"`
+	Role       string              `json:"role"`
+	Term       int                 `json:"term"`
+	JournalLen int                 `json:"journal_len"`
+	Alive      bool                `json:"alive"`
+	Rejected   uint64              `json:"rejected"`
+	SendQueues []SendQueueResponse `json:"send_queues,omitempty"`
+}
+
+// SendQueueResponse holds the counters of the queue of messages to one peer.
+type SendQueueResponse struct {
+	Peer    string `json:"peer"`
+	Queued  uint64 `json:"queued"`
+	Dropped uint64 `json:"dropped"`
+	Pending int    `json:"pending"`
 }
 
 type NodesResponse struct {
 	Nodes []NodeResponse `json:"nodes"`
 }
 
+type JournalEntry struct {
+	Index     int    `json:"index"`
+	Term      int    `json:"term"`
+	Committed bool   `json:"committed"`
+	Applied   bool   `json:"applied"`
+	Error     string `json:"error,omitempty"`
+	Type      string `json:"type"`
+	Data      any    `json:"data"`
+}
+
 type JournalResponse struct {
-	Id  string   `json:"id"`
-	Log []string `json:"log"`
+	Id      string         `json:"id"`
+	Entries []JournalEntry `json:"entries"`
 }
 
 type RequestResponse struct {
+	Id     string `json:"id"`
+	Op     string `json:"op"`
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Index  int    `json:"index"`
+	Result any    `json:"result"`
+}
+
+type CounterResponse struct {
 	Id    string `json:"id"`
+	Index int    `json:"index"`
 	Key   string `json:"key"`
-	Value string `json:"value"`
+	Value any    `json:"value"`
+}
+
+type TxnResponse struct {
+	Id        string                `json:"id"`
+	Index     int                   `json:"index"`
+	Branch    string                `json:"branch"`
+	Responses []raftmap.Result[any] `json:"responses"`
+}
+
+type LockResponse struct {
+	Id    string `json:"id"`
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Token int    `json:"token"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+type QueueResponse struct {
+	Id         string          `json:"id"`
+	Index      int             `json:"index"`
+	Queue      string          `json:"queue"`
+	Message    int             `json:"message"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Deliveries int             `json:"deliveries"`
+	Receipt    int             `json:"receipt,omitempty"`
+}
+
+type ScanResponse struct {
+	Id      string                      `json:"id"`
+	Entries []raftmap.Pair[string, any] `json:"entries"`
+	Cursor  string                      `json:"cursor,omitempty"`
 }
 
 type DumpResponse struct {
@@ -29,26 +97,62 @@ type DumpResponse struct {
 }
 
 type GetResponse struct {
-	Id    string `json:"id"`
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Id       string `json:"id"`
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Revision int    `json:"revision"`
+	TTL      string `json:"ttl,omitempty"`
+}
+
+type CompactResponse struct {
+	Id       string `json:"id"`
+	Index    int    `json:"index"`
+	Revision int    `json:"revision"`
 }
 
 type ConnectResponse struct {
-	Node   string `json:"node"`
-	With   string `json:"with"`
-	Status bool   `json:"status"`
+	Node      string `json:"node"`
+	With      string `json:"with"`
+	Direction string `json:"direction"`
+	Status    bool   `json:"status"`
 }
 
 type DisconnectResponse struct {
-	Node   string `json:"node"`
-	With   string `json:"with"`
-	Status bool   `json:"status"`
+	Node      string `json:"node"`
+	With      string `json:"with"`
+	Direction string `json:"direction"`
+	Status    bool   `json:"status"`
 }
 
+// NodesStatus describes the link to one peer. Connected is true when
+// messages flow both ways, Outbound and Inbound describe each way.
 type NodesStatus struct {
-	Node      string `json:"node"`
-	Connected bool   `json:"connected"`
+	Node      string     `json:"node"`
+	Connected bool       `json:"connected"`
+	Outbound  bool       `json:"outbound"`
+	Inbound   bool       `json:"inbound"`
+	Fault     *LinkFault `json:"fault,omitempty"`
+}
+
+// LinkFault is the fault policy of a link, see node.Fault.
+type LinkFault struct {
+	Drop      float64 `json:"drop"`
+	Duplicate float64 `json:"duplicate"`
+	Delay     string  `json:"delay"`
+	Jitter    string  `json:"jitter"`
+	Reorder   string  `json:"reorder"`
+}
+
+// PartitionResponse lists the groups of nodes that can reach each other.
+type PartitionResponse struct {
+	Groups [][]string `json:"groups"`
+}
+
+type LinkResponse struct {
+	Node   string    `json:"node"`
+	With   string    `json:"with"`
+	Status bool      `json:"status"`
+	Fault  LinkFault `json:"fault"`
 }
 
 type TopologyResponse struct {
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+)
+
+const defaultScanLimit = 100
+
+// Scan lists keys in order. It takes either a prefix or a [start, end) range
+// and pages through them with an opaque cursor.
+func (h *Handler) Scan(w http.ResponseWriter, r *http.Request) {
+	raftNode, ok := h.nodeFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := intQuery(r, "limit", defaultScanLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	start, end := q.Get("start"), q.Get("end")
+	if prefix := q.Get("prefix"); prefix != "" {
+		start, end = prefix, raftmap.PrefixEnd(prefix)
+	}
+
+	if cursor := q.Get("cursor"); cursor != "" {
+		next, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		start = max(start, string(next))
+	}
+
+	_, m, ok := h.mapStore(w, raftNode, q.Get("store"))
+	if !ok {
+		return
+	}
+
+	pairs := m.Range(start, end, limit+1)
+
+	res := ScanResponse{
+		Id:      raftNode.Id.String(),
+		Entries: pairs,
+	}
+	if len(pairs) > limit {
+		res.Entries = pairs[:limit]
+		// the smallest key after the last returned one
+		res.Cursor = base64.RawURLEncoding.EncodeToString([]byte(pairs[limit-1].Key + "\x00"))
+	}
+
+	writeJSON(w, res)
+}
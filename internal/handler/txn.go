@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+)
+
+type txnRequest struct {
+	Txn   txnBody `json:"txn"`
+	Store string  `json:"store"`
+	ID    string  `json:"id"`
+}
+
+type txnBody struct {
+	Compare []raftmap.Compare[string, any] `json:"compare"`
+	Then    []txnOperation                 `json:"then"`
+	Else    []txnOperation                 `json:"else"`
+}
+
+// txnOperation is a raftmap.Command as sent to /txn: ttl is a duration
+// string like in /request.
+type txnOperation struct {
+	Op       raftmap.Op `json:"op"`
+	Key      string     `json:"key"`
+	Value    any        `json:"value,omitempty"`
+	Expected any        `json:"expected,omitempty"`
+	TTL      string     `json:"ttl,omitempty"`
+	Delta    int64      `json:"delta,omitempty"`
+	Min      *int64     `json:"min,omitempty"`
+	Max      *int64     `json:"max,omitempty"`
+}
+
+func (b txnBody) txn() (*raftmap.Txn[string, any], error) {
+	then, err := txnCommands(b.Then)
+	if err != nil {
+		return nil, err
+	}
+	els, err := txnCommands(b.Else)
+	if err != nil {
+		return nil, err
+	}
+	return &raftmap.Txn[string, any]{Compare: b.Compare, Then: then, Else: els}, nil
+}
+
+func txnCommands(ops []txnOperation) ([]raftmap.Command[string, any], error) {
+	cmds := make([]raftmap.Command[string, any], 0, len(ops))
+	for i, op := range ops {
+		var ttl time.Duration
+		if op.TTL != "" {
+			var err error
+			ttl, err = time.ParseDuration(op.TTL)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("invalid ttl in operation %d", i)
+			}
+		}
+		cmds = append(cmds, raftmap.Command[string, any]{
+			Op:       op.Op,
+			Key:      op.Key,
+			Value:    op.Value,
+			Expected: op.Expected,
+			TTL:      ttl,
+			Delta:    op.Delta,
+			Min:      op.Min,
+			Max:      op.Max,
+		})
+	}
+	return cmds, nil
+}
+
+// Txn applies a compare/then/else transaction as a single journal entry.
+func (h *Handler) Txn(w http.ResponseWriter, r *http.Request) {
+	var req txnRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txn, err := req.Txn.txn()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	raftNode, ok := h.nodeFromBody(w, req.ID)
+	if !ok {
+		return
+	}
+
+	name, _, ok := h.mapStore(w, raftNode, req.Store)
+	if !ok {
+		return
+	}
+
+	applied, ok := propose(h, w, r, raftNode, name, raftmap.Command[string, any]{Op: raftmap.OpTxn, Txn: txn})
+	if !ok {
+		return
+	}
+
+	result, _ := applied.Result.(raftmap.TxnResult[any])
+
+	res := TxnResponse{
+		Id:        req.ID,
+		Index:     applied.Index,
+		Branch:    "else",
+		Responses: result.Responses,
+	}
+	if result.Succeeded {
+		res.Branch = "then"
+	}
+
+	writeJSON(w, res)
+}
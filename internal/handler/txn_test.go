@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+)
+
+func TestTxnBody(t *testing.T) {
+	var body txnBody
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"compare": [{"key": "a", "op": "missing"}],
+		"then": [{"op": "put", "key": "a", "value": "1", "ttl": "10s"}],
+		"else": [{"op": "incr", "key": "b", "delta": 2}]
+	}`), &body))
+
+	txn, err := body.txn()
+	require.NoError(t, err)
+	require.Equal(t, &raftmap.Txn[string, any]{
+		Compare: []raftmap.Compare[string, any]{{Key: "a", Op: raftmap.CompareMissing}},
+		Then:    []raftmap.Command[string, any]{{Op: raftmap.OpPut, Key: "a", Value: "1", TTL: 10 * time.Second}},
+		Else:    []raftmap.Command[string, any]{{Op: raftmap.OpIncrement, Key: "b", Delta: 2}},
+	}, txn)
+
+	for _, ttl := range []string{"10", "-1s", "soon"} {
+		body.Then[0].TTL = ttl
+		_, err := body.txn()
+		require.Error(t, err, ttl)
+	}
+}
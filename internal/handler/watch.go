@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	raftmap "github.com/peyuaa/raft/internal/map"
+)
+
+// Watch streams changes of a key or prefix as Server-Sent Events. Each event
+// id is the journal index, so a reconnecting client resumes after the
+// Last-Event-ID it saw.
+func (h *Handler) Watch(w http.ResponseWriter, r *http.Request) {
+	raftNode, ok := h.nodeFromQuery(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	key, prefix := q.Get("key"), q.Has("prefix")
+	if prefix {
+		key = q.Get("prefix")
+	}
+	if key == "" && !prefix {
+		http.Error(w, "key or prefix is required", http.StatusBadRequest)
+		return
+	}
+
+	from, err := intQuery(r, "from", raftNode.Journal.LastApplied()+1)
+	if err != nil {
+		http.Error(w, "invalid from index", http.StatusBadRequest)
+		return
+	}
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		idx, err := strconv.Atoi(last)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		from = idx + 1
+	}
+
+	_, m, ok := h.mapStore(w, raftNode, q.Get("store"))
+	if !ok {
+		return
+	}
+
+	sub, err := m.Watch(key, prefix, from)
+	if errors.Is(err, raftmap.ErrCompacted) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		e, err := sub.Next(r.Context())
+		if errors.Is(err, raftmap.ErrLagging) {
+			_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+			flusher.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Index, e.Type, data)
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,118 @@
+package journal
+
+import "context"
+
+// ApplyResult is the outcome of applying a single committed entry.
+type ApplyResult struct {
+	ID     string
+	Index  int
+	Result any
+	Err    error
+}
+
+// OnApply registers a callback invoked by the applier after every entry.
+// Callbacks run on the applier goroutine and must not block.
+func (j *Journal) OnApply(f func(ApplyResult)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.listeners = append(j.listeners, f)
+}
+
+// Run feeds committed entries to the processor in index order until ctx is
+// done.
+func (j *Journal) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case index := <-j.commits:
+			j.apply(index)
+		}
+	}
+}
+
+func (j *Journal) apply(index int) {
+	j.applyMu.Lock()
+	defer j.applyMu.Unlock()
+
+	entry := j.Get(index)
+
+	var (
+		result any
+		err    error
+	)
+	if now, ok := entry.Tick(); ok {
+		if clock, ok := j.processor.(Clock); ok {
+			clock.Tick(index, now)
+		}
+	} else {
+		result, err = j.processor.Process(entry)
+	}
+
+	j.mu.Lock()
+	j.lastApplied = index
+	if err != nil {
+		j.rememberError(index, err)
+	}
+	listeners := j.listeners
+	j.mu.Unlock()
+
+	res := ApplyResult{ID: entry.ID, Index: index, Result: result, Err: err}
+	for _, f := range listeners {
+		f(res)
+	}
+}
+
+// rememberError keeps err for ApplyError, forgetting the oldest error once
+// maxApplyErrors are kept. j.mu must be held.
+func (j *Journal) rememberError(index int, err error) {
+	j.applyErrs[index] = err
+	j.errIndexes = append(j.errIndexes, index)
+	if len(j.errIndexes) > maxApplyErrors {
+		delete(j.applyErrs, j.errIndexes[0])
+		j.errIndexes = j.errIndexes[1:]
+	}
+}
+
+// HasDeadlines reports whether the processor waits for tick entries.
+func (j *Journal) HasDeadlines() bool {
+	return hasDeadlines(j.processor)
+}
+
+// Snapshot is the processor state after applying every entry up to Index.
+type Snapshot struct {
+	Index int
+	Data  []byte
+}
+
+// Snapshot captures the processor state between two applied entries.
+func (j *Journal) Snapshot() (Snapshot, error) {
+	j.applyMu.Lock()
+	defer j.applyMu.Unlock()
+
+	data, err := j.processor.Snapshot()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Index: j.LastApplied(), Data: data}, nil
+}
+
+func (j *Journal) LastApplied() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.lastApplied
+}
+
+func (j *Journal) Applied(i int) bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return i >= 0 && i <= j.lastApplied
+}
+
+// ApplyError returns the error the processor reported for entry i, if any.
+// Only the errors of the last maxApplyErrors failed entries are kept.
+func (j *Journal) ApplyError(i int) error {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.applyErrs[i]
+}
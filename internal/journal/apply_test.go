@@ -0,0 +1,151 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errRejected = errors.New("rejected")
+
+type recordingProcessor struct {
+	applied []string
+}
+
+func (p *recordingProcessor) Process(m Message) (any, error) {
+	var s string
+	if err := m.Decode(&s); err != nil {
+		return nil, err
+	}
+	if s == "bad" {
+		return nil, errRejected
+	}
+	p.applied = append(p.applied, s)
+	return len(p.applied), nil
+}
+
+func (p *recordingProcessor) Snapshot() ([]byte, error) {
+	return json.Marshal(p.applied)
+}
+
+func (p *recordingProcessor) Restore(data []byte) error {
+	return json.Unmarshal(data, &p.applied)
+}
+
+func TestApplyInOrder(t *testing.T) {
+	proc := &recordingProcessor{}
+	j := NewJournal(proc, JSONCodec{})
+
+	results := make(chan ApplyResult, 3)
+	j.OnApply(func(res ApplyResult) {
+		results <- res
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go j.Run(ctx)
+
+	for i, v := range []string{"a", "bad", "b"} {
+		cmd, err := j.Encode(v)
+		require.NoError(t, err)
+		require.NoError(t, j.Put(Message{Term: 1, Index: i, Command: cmd}))
+		require.True(t, j.Commit())
+	}
+	require.False(t, j.Commit())
+
+	for i := range 3 {
+		select {
+		case res := <-results:
+			require.Equal(t, i, res.Index)
+		case <-time.After(time.Second):
+			t.Fatal("entry was not applied")
+		}
+	}
+
+	require.Equal(t, 2, j.LastApplied())
+	require.Equal(t, []string{"a", "b"}, proc.applied)
+	require.NoError(t, j.ApplyError(0))
+	require.ErrorIs(t, j.ApplyError(1), errRejected)
+
+	snap, err := j.Snapshot()
+	require.NoError(t, err)
+	require.Equal(t, 2, snap.Index)
+	require.JSONEq(t, `["a","b"]`, string(snap.Data))
+}
+
+func TestApplyErrorsBounded(t *testing.T) {
+	j := NewJournal(&recordingProcessor{}, JSONCodec{})
+
+	cmd, err := j.Encode("bad")
+	require.NoError(t, err)
+	n := maxApplyErrors + 10
+	for i := range n {
+		require.NoError(t, j.Put(Message{Term: 1, Index: i, Command: cmd}))
+		require.True(t, j.Commit())
+		j.apply(<-j.commits)
+	}
+
+	require.Len(t, j.applyErrs, maxApplyErrors)
+	require.NoError(t, j.ApplyError(9))
+	require.ErrorIs(t, j.ApplyError(10), errRejected)
+	require.ErrorIs(t, j.ApplyError(n-1), errRejected)
+}
+
+type clockProcessor struct {
+	recordingProcessor
+	ticks []time.Time
+}
+
+func (p *clockProcessor) Tick(_ int, now time.Time) {
+	p.ticks = append(p.ticks, now)
+}
+
+func TestApplyTick(t *testing.T) {
+	proc := &clockProcessor{}
+	j := NewJournal(proc, JSONCodec{})
+
+	now := time.Unix(1700000000, 42)
+	require.NoError(t, j.Put(Message{Term: 1, Index: 0, Command: NewTick(now)}))
+	require.True(t, j.Commit())
+	j.apply(<-j.commits)
+
+	require.Len(t, proc.ticks, 1)
+	require.True(t, now.Equal(proc.ticks[0]))
+	require.Empty(t, proc.applied)
+	require.NoError(t, j.ApplyError(0))
+}
+
+func TestTruncate(t *testing.T) {
+	j := NewJournal(&recordingProcessor{}, JSONCodec{})
+	for i, v := range []string{"a", "b", "c"} {
+		cmd, err := j.Encode(v)
+		require.NoError(t, err)
+		require.NoError(t, j.Put(Message{Term: 1, Index: i, Command: cmd}))
+	}
+	require.True(t, j.Commit())
+
+	// an iterator started before the truncation keeps the entries it saw
+	next, stop := iter.Pull(j.Entries())
+	defer stop()
+	_, ok := next()
+	require.True(t, ok)
+
+	require.ErrorIs(t, j.Truncate(0), ErrCommitted)
+	require.NoError(t, j.Truncate(1))
+	require.Equal(t, 1, j.Len())
+	require.NoError(t, j.Truncate(5))
+	require.Equal(t, 1, j.Len())
+
+	cmd, err := j.Encode("d")
+	require.NoError(t, err)
+	require.NoError(t, j.Put(Message{Term: 2, Index: 1, Command: cmd}))
+
+	m, ok := next()
+	require.True(t, ok)
+	require.Equal(t, 1, m.Term)
+}
@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec serializes the commands carried by journal entries.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var codecs = map[string]Codec{}
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(GobCodec{})
+}
+
+// RegisterCodec makes a codec available for decoding under its name.
+func RegisterCodec(c Codec) {
+	codecs[c.Name()] = c
+}
+
+// CodecByName returns a registered codec. An empty name selects JSON.
+func CodecByName(name string) (Codec, error) {
+	if name == "" {
+		return JSONCodec{}, nil
+	}
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec `%s`", name)
+	}
+	return c, nil
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec is a compact binary codec. Values stored in interface fields
+// must be registered with gob.Register.
+type GobCodec struct{}
+
+func (GobCodec) Name() string {
+	return "gob"
+}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// Command is an encoded journal payload tagged with the codec that produced
+// it. ID identifies the client request that proposed it and Machine names
+// the registered state machine it is addressed to, if any.
+type Command struct {
+	ID      string `json:"id,omitempty"`
+	Machine string `json:"machine,omitempty"`
+	Type    string `json:"type"`
+	Data    []byte `json:"data"`
+}
+
+// Encode serializes v with the given codec.
+func Encode(c Codec, v any) (Command, error) {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return Command{}, err
+	}
+	return Command{Type: c.Name(), Data: data}, nil
+}
+
+// Decode deserializes the command into v using the codec named by its type
+// tag.
+func (c Command) Decode(v any) error {
+	codec, ok := codecs[c.Type]
+	if !ok {
+		return fmt.Errorf("unknown codec `%s`", c.Type)
+	}
+	return codec.Unmarshal(c.Data, v)
+}
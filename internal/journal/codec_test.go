@@ -0,0 +1,34 @@
+package journal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCommand struct {
+	Key   string
+	Value int
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			cmd, err := Encode(codec, testCommand{Key: "hello", Value: 42})
+			require.NoError(t, err)
+			require.Equal(t, codec.Name(), cmd.Type)
+
+			var got testCommand
+			require.NoError(t, cmd.Decode(&got))
+			require.Equal(t, testCommand{Key: "hello", Value: 42}, got)
+		})
+	}
+}
+
+func TestCodecUnknown(t *testing.T) {
+	_, err := CodecByName("xml")
+	require.Error(t, err)
+
+	var v testCommand
+	require.Error(t, Command{Type: "xml"}.Decode(&v))
+}
@@ -0,0 +1,72 @@
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCommand = errors.New("invalid command")
+
+// Entry is a committed journal entry with its command decoded.
+type Entry[C any] struct {
+	Index   int
+	Term    int
+	Command C
+}
+
+// FSM is a replicated state machine over commands of type C. Apply must be
+// deterministic: every replica applies the same entries in the same order.
+// Snapshot and Restore are the contract for snapshot transfer, which nodes
+// do not do yet: they keep their whole journal, so nothing calls Restore
+// outside of tests.
+type FSM[C any] interface {
+	Apply(Entry[C]) (any, error)
+	Snapshot() ([]byte, error)
+	Restore([]byte) error
+}
+
+// Processor is the untyped form of an FSM the journal applies entries to.
+type Processor interface {
+	Process(Message) (any, error)
+	Snapshot() ([]byte, error)
+	Restore([]byte) error
+}
+
+// Machine adapts a typed FSM to a Processor. Commands are decoded with the
+// codec named by their type tag; entries that do not decode into C fail with
+// ErrInvalidCommand. Ticks are forwarded if the FSM implements Clock, and so
+// is Deadlines.
+func Machine[C any](fsm FSM[C]) Processor {
+	return machine[C]{fsm}
+}
+
+type machine[C any] struct {
+	fsm FSM[C]
+}
+
+func (m machine[C]) Process(msg Message) (any, error) {
+	var c C
+	if err := msg.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCommand, err)
+	}
+	return m.fsm.Apply(Entry[C]{Index: msg.Index, Term: msg.Term, Command: c})
+}
+
+func (m machine[C]) Snapshot() ([]byte, error) {
+	return m.fsm.Snapshot()
+}
+
+func (m machine[C]) Restore(data []byte) error {
+	return m.fsm.Restore(data)
+}
+
+func (m machine[C]) HasDeadlines() bool {
+	return hasDeadlines(m.fsm)
+}
+
+func (m machine[C]) Tick(index int, now time.Time) {
+	if clock, ok := m.fsm.(Clock); ok {
+		clock.Tick(index, now)
+	}
+}
@@ -4,43 +4,68 @@ import (
 	"errors"
 	"fmt"
 	"iter"
-	"strconv"
-
-	"github.com/charmbracelet/log"
+	"slices"
+	"sync"
 )
 
 type Message struct {
 	Term  int
 	Index int
-	Data  any
+	Command
 }
 
 func (m Message) String() string {
-	return fmt.Sprintf("%d:{TERM:%d, DATA:%s}", m.Index, m.Term, strconv.Quote(fmt.Sprint(m.Data)))
+	return fmt.Sprintf("%d:{TERM:%d, TYPE:%s, DATA:%q}", m.Index, m.Term, m.Type, m.Data)
 }
 
-type Processor[K comparable, V any] interface {
-	Process(any) (any, error)
-	Dump() map[K]V
-	Get(K) (V, bool)
-}
+// applyQueueSize bounds how far the applier may fall behind the commit index
+// before Commit blocks.
+const applyQueueSize = 1000
+
+// maxApplyErrors bounds how many apply errors the journal remembers for
+// ApplyError; the errors of older entries are forgotten.
+const maxApplyErrors = 1000
 
 type Journal struct {
+	mu          sync.RWMutex
+	applyMu     sync.Mutex
 	storage     []Message
 	commitIndex int
-	processor   Processor[any, any]
+	lastApplied int
+	applyErrs   map[int]error
+	errIndexes  []int
+	commits     chan int
+	listeners   []func(ApplyResult)
+	processor   Processor
+	codec       Codec
+}
+
+func NewJournal(processor Processor, codec Codec) *Journal {
+	return &Journal{
+		commitIndex: -1,
+		lastApplied: -1,
+		applyErrs:   make(map[int]error),
+		commits:     make(chan int, applyQueueSize),
+		processor:   processor,
+		codec:       codec,
+		storage:     []Message{},
+	}
 }
 
-func NewJournal(processor Processor[any, any]) *Journal {
-	return &Journal{commitIndex: -1, processor: processor, storage: []Message{}}
+// Encode serializes a client request into a command using the journal codec.
+func (j *Journal) Encode(v any) (Command, error) {
+	return Encode(j.codec, v)
 }
 
 func (j *Journal) Put(m Message) error {
-	if m.Index != j.Len() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if m.Index != len(j.storage) {
 		return errors.New("messages must be added sequentially")
 	}
 
-	if j.Len() > 0 && j.storage[j.PrevIndex()].Term > m.Term {
+	if len(j.storage) > 0 && j.storage[len(j.storage)-1].Term > m.Term {
 		return errors.New("term of the new message must be greater than or equal to the last term")
 	}
 
@@ -48,26 +73,51 @@ func (j *Journal) Put(m Message) error {
 	return nil
 }
 
+// ErrCommitted is returned when an operation would drop committed entries.
+var ErrCommitted = errors.New("entry is committed")
+
+// Truncate drops the entries from index i on. Only uncommitted entries can be
+// dropped.
+func (j *Journal) Truncate(i int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if i <= j.commitIndex {
+		return ErrCommitted
+	}
+	if i < len(j.storage) {
+		// Range reads the storage without the lock; clipping makes the next
+		// Put copy it rather than overwrite entries an iterator may still see
+		j.storage = slices.Clip(j.storage[:i])
+	}
+	return nil
+}
+
+// Commit advances the commit index by one entry and hands it to the applier.
+// It blocks only when the applier is applyQueueSize entries behind.
 func (j *Journal) Commit() bool {
+	j.mu.Lock()
 	if j.commitIndex+1 >= len(j.storage) {
+		j.mu.Unlock()
 		return false
 	}
 	j.commitIndex++
+	index := j.commitIndex
+	j.mu.Unlock()
 
-	_, err := j.processor.Process(j.storage[j.commitIndex].Data)
-	if err != nil {
-		log.Errorf("journal commit err: %v", err)
-		return false
-	}
-
+	j.commits <- index
 	return true
 }
 
 func (j *Journal) CommitIndex() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
 	return j.commitIndex
 }
 
 func (j *Journal) Len() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
 	return len(j.storage)
 }
 
@@ -76,30 +126,53 @@ func (j *Journal) PrevIndex() int {
 }
 
 func (j *Journal) PrevTerm() int {
-	return j.storage[j.PrevIndex()].Term
+	return j.Last().Term
 }
 
 func (j *Journal) Get(i int) Message {
-	if i < 0 || i >= j.Len() {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if i < 0 || i >= len(j.storage) {
 		return Message{}
 	}
 	return j.storage[i]
 }
 
 func (j *Journal) Last() Message {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
 	return j.storage[len(j.storage)-1]
 }
 
 func (j *Journal) Entries() iter.Seq[Message] {
+	return j.Range(0, -1)
+}
+
+// Range yields the entries with indexes in [from, to). A negative to means
+// the end of the journal.
+func (j *Journal) Range(from, to int) iter.Seq[Message] {
 	return func(yield func(Message) bool) {
-		for _, entry := range j.storage {
-			if !yield(entry) {
+		j.mu.RLock()
+		storage := j.storage
+		j.mu.RUnlock()
+
+		if to < 0 || to > len(storage) {
+			to = len(storage)
+		}
+		for i := max(from, 0); i < to; i++ {
+			if !yield(storage[i]) {
 				return
 			}
 		}
 	}
 }
 
-func (j *Journal) Proc() Processor[any, any] {
+func (j *Journal) Committed(i int) bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return i >= 0 && i <= j.commitIndex
+}
+
+func (j *Journal) Proc() Processor {
 	return j.processor
 }
@@ -0,0 +1,114 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+var ErrUnknownMachine = errors.New("unknown state machine")
+
+// Registry multiplexes several named processors over one journal. Each entry
+// is routed by its Command.Machine; ticks reach every machine that implements
+// Clock, in name order.
+type Registry struct {
+	machines map[string]Processor
+}
+
+func NewRegistry() *Registry {
+	return &Registry{machines: make(map[string]Processor)}
+}
+
+// Register adds a processor under name. It must be called before the journal
+// starts applying entries.
+func (r *Registry) Register(name string, p Processor) error {
+	if name == "" {
+		return errors.New("state machine name is required")
+	}
+	if _, ok := r.machines[name]; ok {
+		return fmt.Errorf("state machine `%s` is already registered", name)
+	}
+	r.machines[name] = p
+	return nil
+}
+
+// Name is the name of a machine that applies commands of type C. Proposing
+// through a Name keeps a command from being routed to a machine of another
+// type.
+type Name[C any] string
+
+// RegisterFSM adds fsm to r under name.
+func RegisterFSM[C any](r *Registry, name Name[C], fsm FSM[C]) error {
+	return r.Register(string(name), Machine[C](fsm))
+}
+
+// Machine returns the processor registered under name.
+func (r *Registry) Machine(name string) (Processor, bool) {
+	p, ok := r.machines[name]
+	return p, ok
+}
+
+// Names returns the registered machine names in order.
+func (r *Registry) Names() []string {
+	return slices.Sorted(maps.Keys(r.machines))
+}
+
+func (r *Registry) Process(msg Message) (any, error) {
+	p, ok := r.machines[msg.Machine]
+	if !ok {
+		return nil, fmt.Errorf("%w: %w `%s`", ErrInvalidCommand, ErrUnknownMachine, msg.Machine)
+	}
+	return p.Process(msg)
+}
+
+func (r *Registry) Tick(index int, now time.Time) {
+	for _, name := range r.Names() {
+		if clock, ok := r.machines[name].(Clock); ok {
+			clock.Tick(index, now)
+		}
+	}
+}
+
+// HasDeadlines reports whether any machine waits for ticks.
+func (r *Registry) HasDeadlines() bool {
+	for _, p := range r.machines {
+		if hasDeadlines(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot encodes the snapshots of every machine keyed by name.
+func (r *Registry) Snapshot() ([]byte, error) {
+	snap := make(map[string][]byte, len(r.machines))
+	for name, p := range r.machines {
+		data, err := p.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot `%s`: %w", name, err)
+		}
+		snap[name] = data
+	}
+	return json.Marshal(snap)
+}
+
+// Restore restores every machine from its part of a registry snapshot. The
+// snapshot must cover exactly the registered machines.
+func (r *Registry) Restore(data []byte) error {
+	var snap map[string][]byte
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if !slices.Equal(slices.Sorted(maps.Keys(snap)), r.Names()) {
+		return fmt.Errorf("snapshot machines %v do not match registered %v", slices.Sorted(maps.Keys(snap)), r.Names())
+	}
+	for _, name := range r.Names() {
+		if err := r.machines[name].Restore(snap[name]); err != nil {
+			return fmt.Errorf("restore `%s`: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	config := &recordingProcessor{}
+	queues := &clockProcessor{}
+
+	r := NewRegistry()
+	require.NoError(t, r.Register("config", config))
+	require.NoError(t, r.Register("queues", queues))
+	require.Error(t, r.Register("config", &recordingProcessor{}))
+	require.Equal(t, []string{"config", "queues"}, r.Names())
+	// a Clock that cannot tell is assumed to wait for ticks
+	require.True(t, r.HasDeadlines())
+
+	j := NewJournal(r, JSONCodec{})
+	put := func(index int, machine, v string) {
+		cmd, err := j.Encode(v)
+		require.NoError(t, err)
+		cmd.Machine = machine
+		require.NoError(t, j.Put(Message{Term: 1, Index: index, Command: cmd}))
+		require.True(t, j.Commit())
+		j.apply(<-j.commits)
+	}
+
+	put(0, "config", "a")
+	put(1, "queues", "b")
+	put(2, "locks", "c")
+	put(3, "config", "d")
+	require.NoError(t, j.Put(Message{Term: 1, Index: 4, Command: NewTick(time.Unix(1, 0))}))
+	require.True(t, j.Commit())
+	j.apply(<-j.commits)
+
+	require.Equal(t, []string{"a", "d"}, config.applied)
+	require.Equal(t, []string{"b"}, queues.applied)
+	require.Len(t, queues.ticks, 1)
+	require.ErrorIs(t, j.ApplyError(2), ErrUnknownMachine)
+	require.ErrorIs(t, j.ApplyError(2), ErrInvalidCommand)
+
+	data, err := r.Snapshot()
+	require.NoError(t, err)
+
+	restored := NewRegistry()
+	restoredConfig := &recordingProcessor{}
+	restoredQueues := &recordingProcessor{}
+	require.NoError(t, restored.Register("config", restoredConfig))
+	require.NoError(t, restored.Register("queues", restoredQueues))
+	require.NoError(t, restored.Restore(data))
+	require.Equal(t, config.applied, restoredConfig.applied)
+	require.Equal(t, queues.applied, restoredQueues.applied)
+
+	other := NewRegistry()
+	require.NoError(t, other.Register("config", &recordingProcessor{}))
+	require.Error(t, other.Restore(data))
+	require.False(t, other.HasDeadlines())
+}
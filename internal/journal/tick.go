@@ -0,0 +1,69 @@
+package journal
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// TickType tags entries that carry the leader's clock instead of a client
+// command.
+const TickType = "tick"
+
+// Clock is implemented by processors whose state depends on time. Tick is
+// called with the index and leader-proposed time of every applied tick entry,
+// so every replica observes the same time at the same index.
+type Clock interface {
+	Tick(index int, now time.Time)
+}
+
+// Deadlines is implemented by clocks that know whether anything waits for
+// time to pass. A leader only proposes tick entries while some processor has
+// a deadline pending; a Clock without Deadlines is assumed to always have one.
+type Deadlines interface {
+	HasDeadlines() bool
+}
+
+// hasDeadlines reports whether p, a Processor or an FSM, needs tick entries.
+func hasDeadlines(p any) bool {
+	if d, ok := p.(Deadlines); ok {
+		return d.HasDeadlines()
+	}
+	_, ok := p.(Clock)
+	return ok
+}
+
+func NewTick(now time.Time) Command {
+	return Command{Type: TickType, Data: binary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))}
+}
+
+// Tick returns the time carried by a tick entry.
+func (c Command) Tick() (time.Time, bool) {
+	if c.Type != TickType || len(c.Data) != 8 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(c.Data))), true
+}
+
+// ElapsedClock measures the time elapsed across applied ticks. It never moves
+// backwards, so a new leader whose clock is behind cannot undo elapsed time.
+type ElapsedClock struct {
+	Elapsed time.Duration `json:"elapsed"`
+	Last    time.Time     `json:"last"`
+}
+
+// Restart makes the next Advance count from its own time. Processors call it
+// when their first deadline is set: the leader proposes no ticks while
+// nothing waits, so the gap since the previous tick must not count.
+func (c *ElapsedClock) Restart() {
+	c.Last = time.Time{}
+}
+
+// Advance adds the time passed since the previous tick.
+func (c *ElapsedClock) Advance(now time.Time) {
+	if !c.Last.IsZero() && now.After(c.Last) {
+		c.Elapsed += now.Sub(c.Last)
+	}
+	if now.After(c.Last) {
+		c.Last = now
+	}
+}
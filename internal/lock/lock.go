@@ -0,0 +1,179 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrHeld           = errors.New("lock is held by another owner")
+	ErrNotHolder      = errors.New("not the lock holder")
+)
+
+type Op string
+
+const (
+	OpAcquire Op = "acquire"
+	OpRenew   Op = "renew"
+	OpRelease Op = "release"
+)
+
+// Command is the envelope understood by Table.Apply. Token is required by
+// renew and release and must be the token returned by acquire.
+type Command struct {
+	Op    Op            `json:"op"`
+	Name  string        `json:"name"`
+	Owner string        `json:"owner"`
+	Lease time.Duration `json:"lease,omitempty"`
+	Token int           `json:"token,omitempty"`
+}
+
+// Lease is a held lock. Token is the journal index of the entry that granted
+// the lock, so tokens of successive holders strictly increase and can be used
+// to fence out stale holders. Deadline is on the tick-driven clock.
+type Lease struct {
+	Owner    string        `json:"owner"`
+	Token    int           `json:"token"`
+	Deadline time.Duration `json:"deadline"`
+}
+
+// Result describes the lock after a command. On ErrHeld it describes the
+// current holder.
+type Result struct {
+	Owner string        `json:"owner"`
+	Token int           `json:"token"`
+	TTL   time.Duration `json:"ttl"`
+}
+
+// Table is a replicated lock table. Leases expire only when tick entries are
+// applied, so every replica frees a lock at the same index.
+type Table struct {
+	mu    sync.RWMutex
+	locks map[string]Lease
+	clock journal.ElapsedClock
+}
+
+var _ journal.FSM[Command] = (*Table)(nil)
+
+func New() *Table {
+	return &Table{locks: make(map[string]Lease)}
+}
+
+func (t *Table) Apply(e journal.Entry[Command]) (any, error) {
+	c := e.Command
+	if c.Name == "" || c.Owner == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, held := t.locks[c.Name]
+	if held && l.Deadline <= t.clock.Elapsed {
+		held = false
+	}
+
+	switch c.Op {
+	case OpAcquire:
+		if c.Lease <= 0 {
+			return nil, ErrInvalidRequest
+		}
+		if held && l.Owner != c.Owner {
+			return t.result(l), ErrHeld
+		}
+		if !held {
+			l = Lease{Owner: c.Owner, Token: e.Index}
+		}
+	case OpRenew:
+		if c.Lease <= 0 {
+			return nil, ErrInvalidRequest
+		}
+		if !held || l.Owner != c.Owner || l.Token != c.Token {
+			return nil, ErrNotHolder
+		}
+	case OpRelease:
+		if !held || l.Owner != c.Owner || l.Token != c.Token {
+			return nil, ErrNotHolder
+		}
+		delete(t.locks, c.Name)
+		return Result{Owner: l.Owner, Token: l.Token}, nil
+	default:
+		return nil, ErrInvalidRequest
+	}
+
+	if len(t.locks) == 0 {
+		t.clock.Restart()
+	}
+	l.Deadline = t.clock.Elapsed + c.Lease
+	t.locks[c.Name] = l
+	return t.result(l), nil
+}
+
+func (t *Table) result(l Lease) Result {
+	return Result{Owner: l.Owner, Token: l.Token, TTL: l.Deadline - t.clock.Elapsed}
+}
+
+// Tick advances the lease clock and frees expired locks.
+func (t *Table) Tick(_ int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clock.Advance(now)
+	for name, l := range t.locks {
+		if l.Deadline <= t.clock.Elapsed {
+			delete(t.locks, name)
+		}
+	}
+}
+
+// HasDeadlines reports whether some lease is waiting to run out.
+func (t *Table) HasDeadlines() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.locks) > 0
+}
+
+// Get returns the current holder of a lock.
+func (t *Table) Get(name string) (Result, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	l, ok := t.locks[name]
+	if !ok || l.Deadline <= t.clock.Elapsed {
+		return Result{}, false
+	}
+	return t.result(l), true
+}
+
+type snapshot struct {
+	Locks map[string]Lease     `json:"locks"`
+	Clock journal.ElapsedClock `json:"clock"`
+}
+
+func (t *Table) Snapshot() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return json.Marshal(snapshot{Locks: t.locks, Clock: t.clock})
+}
+
+func (t *Table) Restore(data []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.locks = s.Locks
+	if t.locks == nil {
+		t.locks = make(map[string]Lease)
+	}
+	t.clock = s.Clock
+	return nil
+}
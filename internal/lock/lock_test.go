@@ -0,0 +1,145 @@
+package lock
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestTable(t *testing.T) {
+	tbl := New()
+	start := time.Unix(100, 0)
+	tbl.Tick(0, start)
+
+	apply := func(index int, c Command) (Result, error) {
+		res, err := tbl.Apply(journal.Entry[Command]{Index: index, Command: c})
+		r, _ := res.(Result)
+		return r, err
+	}
+
+	res, err := apply(1, Command{Op: OpAcquire, Name: "job", Owner: "alice", Lease: 10 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, Result{Owner: "alice", Token: 1, TTL: 10 * time.Second}, res)
+
+	res, err = apply(2, Command{Op: OpAcquire, Name: "job", Owner: "bob", Lease: 10 * time.Second})
+	require.ErrorIs(t, err, ErrHeld)
+	require.Equal(t, "alice", res.Owner)
+
+	// acquiring again keeps the token
+	res, err = apply(3, Command{Op: OpAcquire, Name: "job", Owner: "alice", Lease: 5 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Token)
+
+	_, err = apply(4, Command{Op: OpRenew, Name: "job", Owner: "alice", Token: 3, Lease: time.Second})
+	require.ErrorIs(t, err, ErrNotHolder)
+
+	tbl.Tick(5, start.Add(4*time.Second))
+	res, err = apply(6, Command{Op: OpRenew, Name: "job", Owner: "alice", Token: 1, Lease: 2 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Second, res.TTL)
+
+	// the lease runs out and bob gets a newer token
+	tbl.Tick(7, start.Add(6*time.Second))
+	_, ok := tbl.Get("job")
+	require.False(t, ok)
+
+	res, err = apply(8, Command{Op: OpAcquire, Name: "job", Owner: "bob", Lease: 10 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, 8, res.Token)
+
+	_, err = apply(9, Command{Op: OpRelease, Name: "job", Owner: "alice", Token: 1})
+	require.ErrorIs(t, err, ErrNotHolder)
+
+	require.True(t, tbl.HasDeadlines())
+	_, err = apply(10, Command{Op: OpRelease, Name: "job", Owner: "bob", Token: 8})
+	require.NoError(t, err)
+	_, ok = tbl.Get("job")
+	require.False(t, ok)
+	require.False(t, tbl.HasDeadlines())
+
+	_, err = apply(11, Command{Op: OpAcquire, Name: "job", Owner: "bob"})
+	require.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+// TestTableFencing interleaves two clients at random and checks that a
+// fencing token is never granted to both of them and that every new holder
+// gets a larger token than the previous one.
+func TestTableFencing(t *testing.T) {
+	tbl := New()
+	rnd := rand.New(rand.NewPCG(5, 6))
+	now := time.Unix(0, 0)
+	owners := []string{"alice", "bob"}
+
+	// tokens the clients believe they hold
+	held := map[string]int{}
+	tokenOwner := map[int]string{}
+	lastToken := -1
+
+	for index := range 10000 {
+		owner := owners[rnd.IntN(len(owners))]
+		lease := time.Duration(1+rnd.IntN(5)) * time.Second
+
+		var c Command
+		switch rnd.IntN(4) {
+		case 0:
+			now = now.Add(time.Duration(rnd.IntN(3000)) * time.Millisecond)
+			tbl.Tick(index, now)
+			continue
+		case 1:
+			c = Command{Op: OpAcquire, Name: "job", Owner: owner, Lease: lease}
+		case 2:
+			c = Command{Op: OpRenew, Name: "job", Owner: owner, Token: held[owner], Lease: lease}
+		case 3:
+			c = Command{Op: OpRelease, Name: "job", Owner: owner, Token: held[owner]}
+		}
+
+		res, err := tbl.Apply(journal.Entry[Command]{Index: index, Command: c})
+		if err != nil {
+			continue
+		}
+		r := res.(Result)
+		require.Equal(t, owner, r.Owner)
+
+		if prev, ok := tokenOwner[r.Token]; ok {
+			require.Equal(t, owner, prev, "token %d granted to two owners", r.Token)
+		} else {
+			require.Greater(t, r.Token, lastToken)
+			lastToken = r.Token
+			tokenOwner[r.Token] = owner
+		}
+
+		if c.Op == OpRelease {
+			delete(held, owner)
+		} else {
+			held[owner] = r.Token
+		}
+
+		cur, ok := tbl.Get("job")
+		if ok {
+			require.Equal(t, lastToken, cur.Token)
+		}
+	}
+
+	require.Greater(t, len(tokenOwner), 100)
+}
+
+func TestTableSnapshot(t *testing.T) {
+	tbl := New()
+	tbl.Tick(0, time.Unix(0, 0))
+	_, err := tbl.Apply(journal.Entry[Command]{Index: 1, Command: Command{Op: OpAcquire, Name: "job", Owner: "alice", Lease: time.Minute}})
+	require.NoError(t, err)
+
+	data, err := tbl.Snapshot()
+	require.NoError(t, err)
+
+	restored := New()
+	require.NoError(t, restored.Restore(data))
+
+	res, ok := restored.Get("job")
+	require.True(t, ok)
+	require.Equal(t, Result{Owner: "alice", Token: 1, TTL: time.Minute}, res)
+}
@@ -0,0 +1,115 @@
+package raftmap
+
+import (
+	"errors"
+	"math"
+	"reflect"
+)
+
+var (
+	ErrNotNumber  = errors.New("value is not an integer")
+	ErrOverflow   = errors.New("integer overflow")
+	ErrOutOfRange = errors.New("value out of range")
+)
+
+// add applies a counter command to k. A missing key counts as zero. The new
+// value must fit in an int64 and lie within [Min, Max] when they are set,
+// otherwise the key is left unchanged. An existing TTL is kept unless the
+// command sets a new one.
+func (m *Map[K, V]) add(c Command[K, V], prev V, existed bool) (V, error) {
+	var zero V
+
+	var cur int64
+	if existed {
+		n, ok := integer(prev)
+		if !ok {
+			return zero, ErrNotNumber
+		}
+		cur = n
+	}
+
+	delta := c.Delta
+	if c.Op == OpDecrement {
+		if delta == math.MinInt64 {
+			return zero, ErrOverflow
+		}
+		delta = -delta
+	}
+
+	if delta > 0 && cur > math.MaxInt64-delta || delta < 0 && cur < math.MinInt64-delta {
+		return zero, ErrOverflow
+	}
+	next := cur + delta
+
+	if c.Min != nil && next < *c.Min || c.Max != nil && next > *c.Max {
+		return zero, ErrOutOfRange
+	}
+
+	v, ok := any(next).(V)
+	if !ok {
+		return zero, ErrNotNumber
+	}
+
+	m.set(c.Key, v)
+	if c.TTL > 0 {
+		m.expire(c.Key, c.TTL)
+	}
+	return v, nil
+}
+
+// integer returns v as an int64 if it is an integer or an integral float.
+// Floats appear when numbers went through the JSON codec or a snapshot.
+func integer(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return uintInteger(uint64(n))
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return uintInteger(n)
+	case float32:
+		return floatInteger(float64(n))
+	case float64:
+		return floatInteger(n)
+	}
+	return 0, false
+}
+
+func uintInteger(n uint64) (int64, bool) {
+	if n > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+func floatInteger(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// equal compares values for CAS and transaction guards. Integers are compared
+// by value so a counter written as int64 still matches a decoded float64.
+func equal[V any](a, b V) bool {
+	x, okA := integer(a)
+	y, okB := integer(b)
+	if okA && okB {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,137 @@
+package raftmap
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestMapCounter(t *testing.T) {
+	bound := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name    string
+		initial map[string]any
+		cmd     Command[string, any]
+		want    map[string]any
+		result  Result[any]
+		err     error
+	}{
+		{
+			name:   "increment missing key starts at zero",
+			cmd:    Command[string, any]{Op: OpIncrement, Key: "n", Delta: 3},
+			want:   map[string]any{"n": int64(3)},
+			result: Result[any]{Value: int64(3)},
+		},
+		{
+			name:    "increment decoded json number",
+			initial: map[string]any{"n": float64(41)},
+			cmd:     Command[string, any]{Op: OpIncrement, Key: "n", Delta: 1},
+			want:    map[string]any{"n": int64(42)},
+			result:  Result[any]{Prev: float64(41), Existed: true, Value: int64(42)},
+		},
+		{
+			name:    "decrement",
+			initial: map[string]any{"n": int64(5)},
+			cmd:     Command[string, any]{Op: OpDecrement, Key: "n", Delta: 7},
+			want:    map[string]any{"n": int64(-2)},
+			result:  Result[any]{Prev: int64(5), Existed: true, Value: int64(-2)},
+		},
+		{
+			name:    "ceiling rejects the increment",
+			initial: map[string]any{"n": int64(10)},
+			cmd:     Command[string, any]{Op: OpIncrement, Key: "n", Delta: 1, Max: bound(10)},
+			want:    map[string]any{"n": int64(10)},
+			result:  Result[any]{Prev: int64(10), Existed: true},
+			err:     ErrOutOfRange,
+		},
+		{
+			name:    "floor rejects the decrement",
+			initial: map[string]any{"n": int64(0)},
+			cmd:     Command[string, any]{Op: OpDecrement, Key: "n", Delta: 1, Min: bound(0)},
+			want:    map[string]any{"n": int64(0)},
+			result:  Result[any]{Prev: int64(0), Existed: true},
+			err:     ErrOutOfRange,
+		},
+		{
+			name:    "overflow",
+			initial: map[string]any{"n": int64(math.MaxInt64)},
+			cmd:     Command[string, any]{Op: OpIncrement, Key: "n", Delta: 1},
+			want:    map[string]any{"n": int64(math.MaxInt64)},
+			result:  Result[any]{Prev: int64(math.MaxInt64), Existed: true},
+			err:     ErrOverflow,
+		},
+		{
+			name:    "underflow",
+			initial: map[string]any{"n": int64(math.MinInt64 + 1)},
+			cmd:     Command[string, any]{Op: OpDecrement, Key: "n", Delta: 2},
+			want:    map[string]any{"n": int64(math.MinInt64 + 1)},
+			result:  Result[any]{Prev: int64(math.MinInt64 + 1), Existed: true},
+			err:     ErrOverflow,
+		},
+		{
+			name:    "string value",
+			initial: map[string]any{"n": "1"},
+			cmd:     Command[string, any]{Op: OpIncrement, Key: "n", Delta: 1},
+			want:    map[string]any{"n": "1"},
+			result:  Result[any]{Prev: "1", Existed: true},
+			err:     ErrNotNumber,
+		},
+		{
+			name:    "cas matches a counter by value",
+			initial: map[string]any{"n": int64(2)},
+			cmd:     Command[string, any]{Op: OpCAS, Key: "n", Value: "done", Expected: float64(2)},
+			want:    map[string]any{"n": "done"},
+			result:  Result[any]{Prev: int64(2), Existed: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New[string, any]()
+			for k, v := range tt.initial {
+				m.m.Set(k, v)
+			}
+
+			cmd, err := journal.Encode(journal.JSONCodec{}, tt.cmd)
+			require.NoError(t, err)
+
+			res, err := process(m, journal.Message{Command: cmd})
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.result, res)
+			require.Equal(t, tt.want, m.Dump())
+		})
+	}
+}
+
+func TestMapCounterTTL(t *testing.T) {
+	m := New[string, any]()
+	m.Tick(0, time.Unix(0, 0))
+
+	apply := func(index int, c Command[string, any]) {
+		_, err := m.Apply(journal.Entry[Command[string, any]]{Index: index, Command: c})
+		require.NoError(t, err)
+	}
+
+	// a rate limit window: the first increment opens it, later ones keep it
+	apply(1, Command[string, any]{Op: OpIncrement, Key: "hits", Delta: 1, TTL: 10 * time.Second})
+	// the map had nothing to expire, so its clock restarts at the next tick
+	// and the idle gap since the previous one does not count
+	m.Tick(2, time.Unix(100, 0))
+	m.Tick(3, time.Unix(104, 0))
+	apply(4, Command[string, any]{Op: OpIncrement, Key: "hits", Delta: 1})
+
+	ttl, ok := m.TTL("hits")
+	require.True(t, ok)
+	require.Equal(t, 6*time.Second, ttl)
+
+	require.True(t, m.HasDeadlines())
+	m.Tick(5, time.Unix(110, 0))
+	_, ok = m.Get("hits")
+	require.False(t, ok)
+	require.False(t, m.HasDeadlines())
+}
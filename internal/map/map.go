@@ -1,44 +1,290 @@
 package raftmap
 
-import "errors"
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
 
-type Map[K comparable, V any] struct {
-	m map[K]V
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+// Map is the replicated key-value store. Keys are kept in order so they can
+// be scanned by range and prefix.
+type Map[K ~string, V any] struct {
+	mu sync.RWMutex
+	m  *skiplist[K, V]
+
+	// clock is the time elapsed according to applied tick entries. Key
+	// deadlines are expressed on this clock, never on the local wall clock.
+	clock   journal.ElapsedClock
+	expires map[K]time.Duration
+
+	// index is the journal index of the entry being applied.
+	index     int
+	pending   []Event[K, V]
+	history   []Event[K, V]
+	compacted int
+	watchers  map[*Watcher[K, V]]struct{}
+
+	revs       map[K][]revision[V]
+	compactRev int
+	retention  int
 }
 
-func New[K comparable, V any]() *Map[K, V] {
-	return &Map[K, V]{m: make(map[K]V)}
+func New[K ~string, V any]() *Map[K, V] {
+	return &Map[K, V]{
+		m:         newSkiplist[K, V](),
+		expires:   make(map[K]time.Duration),
+		compacted: -1,
+		watchers:  make(map[*Watcher[K, V]]struct{}),
+		revs:      make(map[K][]revision[V]),
+		retention: revisionRetention,
+	}
 }
 
-var ErrInvalidRequest = errors.New("invalid request")
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrKeyNotFound    = errors.New("key not found")
+	ErrKeyExists      = errors.New("key already exists")
+	ErrCompareFailed  = errors.New("compare failed")
+)
 
-func (m *Map[K, V]) Process(s any) (any, error) {
-	switch v := s.(type) {
-	case map[string]any:
-		kk, ok1 := v["key"]
-		vv, ok2 := v["value"]
-		if ok1 && ok2 {
-			k, ok := kk.(K)
-			if !ok {
-				return "", ErrInvalidRequest
-			}
-			v, ok := vv.(V)
-			if !ok {
-				return "", ErrInvalidRequest
-			}
+type Op string
 
-			m.m[k] = v
-			return "", nil
+const (
+	OpPut         Op = "put"
+	OpDelete      Op = "delete"
+	OpPutIfAbsent Op = "put_if_absent"
+	OpCAS         Op = "cas"
+	OpTxn         Op = "txn"
+	OpCompact     Op = "compact"
+	OpIncrement   Op = "incr"
+	OpDecrement   Op = "decr"
+)
+
+// Command is the envelope understood by Map.Apply. An empty Op is a put.
+// A positive TTL makes a written key expire after that much tick time. Txn is
+// only set for OpTxn and Revision only for OpCompact; both ignore the other
+// fields. Delta, Min and Max are used by OpIncrement and OpDecrement.
+type Command[K comparable, V any] struct {
+	Op       Op            `json:"op,omitempty"`
+	Key      K             `json:"key"`
+	Value    V             `json:"value,omitempty"`
+	Expected V             `json:"expected,omitempty"`
+	TTL      time.Duration `json:"ttl,omitempty"`
+	Txn      *Txn[K, V]    `json:"txn,omitempty"`
+	Revision int           `json:"revision,omitempty"`
+	Delta    int64         `json:"delta,omitempty"`
+	Min      *int64        `json:"min,omitempty"`
+	Max      *int64        `json:"max,omitempty"`
+}
+
+// Result describes the key before a successful command was applied. Value is
+// only set by counter commands and holds the new value.
+type Result[V any] struct {
+	Prev    V    `json:"prev"`
+	Existed bool `json:"existed"`
+	Value   V    `json:"value,omitempty"`
+}
+
+var _ journal.FSM[Command[string, any]] = (*Map[string, any])(nil)
+
+func (m *Map[K, V]) Apply(e journal.Entry[Command[K, V]]) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.index = e.Index
+	defer m.retain()
+	res, err := m.process(e.Command)
+	if err != nil {
+		m.pending = m.pending[:0]
+		return res, err
+	}
+	m.publish()
+	return res, nil
+}
+
+func (m *Map[K, V]) process(c Command[K, V]) (any, error) {
+	switch c.Op {
+	case OpTxn:
+		return m.txn(c.Txn)
+	case OpCompact:
+		return nil, m.compact(c.Revision)
+	}
+	if c.Key == "" {
+		return nil, ErrInvalidRequest
+	}
+	return m.apply(c)
+}
+
+func (m *Map[K, V]) apply(c Command[K, V]) (Result[V], error) {
+	prev, ok := m.m.Get(c.Key)
+	res := Result[V]{Prev: prev, Existed: ok}
+
+	switch c.Op {
+	case OpPut, "":
+		m.put(c)
+	case OpDelete:
+		if !ok {
+			return res, ErrKeyNotFound
+		}
+		m.delete(c.Key)
+	case OpPutIfAbsent:
+		if ok {
+			return res, ErrKeyExists
 		}
+		m.put(c)
+	case OpCAS:
+		if !ok {
+			return res, ErrKeyNotFound
+		}
+		if !equal(prev, c.Expected) {
+			return res, ErrCompareFailed
+		}
+		m.put(c)
+	case OpIncrement, OpDecrement:
+		v, err := m.add(c, prev, ok)
+		if err != nil {
+			return res, err
+		}
+		res.Value = v
+	default:
+		return res, ErrInvalidRequest
+	}
+
+	return res, nil
+}
+
+func (m *Map[K, V]) put(c Command[K, V]) {
+	m.set(c.Key, c.Value)
+	if c.TTL > 0 {
+		m.expire(c.Key, c.TTL)
+	} else {
+		delete(m.expires, c.Key)
+	}
+}
+
+// expire makes k expire after ttl of tick time.
+func (m *Map[K, V]) expire(k K, ttl time.Duration) {
+	if len(m.expires) == 0 {
+		m.clock.Restart()
 	}
-	return "", ErrInvalidRequest
+	m.expires[k] = m.clock.Elapsed + ttl
+}
+
+func (m *Map[K, V]) set(k K, v V) {
+	m.m.Set(k, v)
+	m.emit(Event[K, V]{Type: EventPut, Key: k, Value: v})
 }
 
+func (m *Map[K, V]) delete(k K) {
+	m.m.Delete(k)
+	delete(m.expires, k)
+	m.emit(Event[K, V]{Type: EventDelete, Key: k})
+}
+
+// Tick advances the map clock by the time elapsed since the previous tick and
+// removes expired keys.
+func (m *Map[K, V]) Tick(index int, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.index = index
+	defer m.retain()
+	defer m.publish()
+
+	m.clock.Advance(now)
+
+	// expire in key order so every replica emits the same events
+	var expired []K
+	for k, deadline := range m.expires {
+		if deadline <= m.clock.Elapsed {
+			expired = append(expired, k)
+		}
+	}
+	slices.Sort(expired)
+	for _, k := range expired {
+		m.delete(k)
+	}
+}
+
+// HasDeadlines reports whether some key is waiting to expire.
+func (m *Map[K, V]) HasDeadlines() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.expires) > 0
+}
+
+// TTL returns the remaining lifetime of k. The second result is false if k
+// does not exist or never expires.
+func (m *Map[K, V]) TTL(k K) (time.Duration, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deadline, ok := m.expires[k]
+	if !ok {
+		return 0, false
+	}
+	return deadline - m.clock.Elapsed, true
+}
+
+// Dump returns a copy of the whole map.
 func (m *Map[K, V]) Dump() map[K]V {
-	return m.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[K]V, m.m.Len())
+	for k, v := range m.m.All() {
+		res[k] = v
+	}
+	return res
 }
 
 func (m *Map[K, V]) Get(k K) (V, bool) {
-	v, ok := m.m[k]
-	return v, ok
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.m.Get(k)
+}
+
+type Pair[K ~string, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+// Range returns up to limit entries with start <= key < end in key order. An
+// empty end means no upper bound and a non-positive limit means no limit.
+func (m *Map[K, V]) Range(start, end K, limit int) []Pair[K, V] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := []Pair[K, V]{}
+	for k, v := range m.m.From(start) {
+		if end != "" && k >= end {
+			break
+		}
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		res = append(res, Pair[K, V]{Key: k, Value: v})
+	}
+	return res
+}
+
+// Prefix returns every entry whose key starts with p in key order.
+func (m *Map[K, V]) Prefix(p K) []Pair[K, V] {
+	return m.Range(p, PrefixEnd(p), 0)
+}
+
+// PrefixEnd returns the smallest key greater than every key starting with p,
+// or an empty key if there is none.
+func PrefixEnd[K ~string](p K) K {
+	b := []byte(p)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return K(b[:i+1])
+		}
+	}
+	return ""
 }
@@ -0,0 +1,253 @@
+package raftmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestMapProcess(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial map[string]string
+		cmd     Command[string, string]
+		want    map[string]string
+		result  Result[string]
+		err     error
+	}{
+		{
+			name:   "put new key",
+			cmd:    Command[string, string]{Op: OpPut, Key: "a", Value: "1"},
+			want:   map[string]string{"a": "1"},
+			result: Result[string]{},
+		},
+		{
+			name:    "put without op overwrites",
+			initial: map[string]string{"a": "1"},
+			cmd:     Command[string, string]{Key: "a", Value: "2"},
+			want:    map[string]string{"a": "2"},
+			result:  Result[string]{Prev: "1", Existed: true},
+		},
+		{
+			name:    "delete existing key",
+			initial: map[string]string{"a": "1", "b": "2"},
+			cmd:     Command[string, string]{Op: OpDelete, Key: "a"},
+			want:    map[string]string{"b": "2"},
+			result:  Result[string]{Prev: "1", Existed: true},
+		},
+		{
+			name: "delete missing key",
+			cmd:  Command[string, string]{Op: OpDelete, Key: "a"},
+			want: map[string]string{},
+			err:  ErrKeyNotFound,
+		},
+		{
+			name: "put if absent stores missing key",
+			cmd:  Command[string, string]{Op: OpPutIfAbsent, Key: "a", Value: "1"},
+			want: map[string]string{"a": "1"},
+		},
+		{
+			name:    "put if absent keeps existing key",
+			initial: map[string]string{"a": "1"},
+			cmd:     Command[string, string]{Op: OpPutIfAbsent, Key: "a", Value: "2"},
+			want:    map[string]string{"a": "1"},
+			result:  Result[string]{Prev: "1", Existed: true},
+			err:     ErrKeyExists,
+		},
+		{
+			name:    "cas with matching value",
+			initial: map[string]string{"a": "1"},
+			cmd:     Command[string, string]{Op: OpCAS, Key: "a", Value: "2", Expected: "1"},
+			want:    map[string]string{"a": "2"},
+			result:  Result[string]{Prev: "1", Existed: true},
+		},
+		{
+			name:    "cas with stale value",
+			initial: map[string]string{"a": "1"},
+			cmd:     Command[string, string]{Op: OpCAS, Key: "a", Value: "2", Expected: "0"},
+			want:    map[string]string{"a": "1"},
+			result:  Result[string]{Prev: "1", Existed: true},
+			err:     ErrCompareFailed,
+		},
+		{
+			name: "cas on missing key",
+			cmd:  Command[string, string]{Op: OpCAS, Key: "a", Value: "2", Expected: "1"},
+			want: map[string]string{},
+			err:  ErrKeyNotFound,
+		},
+		{
+			name: "unknown op",
+			cmd:  Command[string, string]{Op: "rename", Key: "a"},
+			want: map[string]string{},
+			err:  ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New[string, string]()
+			for k, v := range tt.initial {
+				m.m.Set(k, v)
+			}
+
+			cmd, err := journal.Encode(journal.JSONCodec{}, tt.cmd)
+			require.NoError(t, err)
+
+			res, err := process(m, journal.Message{Command: cmd})
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.result, res)
+			require.Equal(t, tt.want, m.Dump())
+		})
+	}
+}
+
+func TestMapProcessInvalid(t *testing.T) {
+	m := New[string, any]()
+
+	cmd, err := journal.Encode(journal.JSONCodec{}, "aboba")
+	require.NoError(t, err)
+
+	_, err = process(m, journal.Message{Command: cmd})
+	require.ErrorIs(t, err, journal.ErrInvalidCommand)
+
+	cmd, err = journal.Encode(journal.JSONCodec{}, Command[string, any]{Value: "no key"})
+	require.NoError(t, err)
+
+	_, err = process(m, journal.Message{Command: cmd})
+	require.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestMapSnapshot(t *testing.T) {
+	m := New[string, string]()
+	for i, c := range []Command[string, string]{
+		{Key: "b", Value: "1", TTL: time.Minute},
+		{Key: "a", Value: "1"},
+		{Key: "a", Value: "2"},
+	} {
+		_, err := m.Apply(journal.Entry[Command[string, string]]{Index: i, Command: c})
+		require.NoError(t, err)
+	}
+	m.Tick(3, time.Unix(10, 0))
+
+	data, err := m.Snapshot()
+	require.NoError(t, err)
+
+	restored := New[string, string]()
+	require.NoError(t, restored.Restore(data))
+
+	require.Equal(t, m.Dump(), restored.Dump())
+	ttl, ok := restored.TTL("b")
+	require.True(t, ok)
+	require.Equal(t, time.Minute, ttl)
+
+	v, rev, err := restored.GetAt("a", 1)
+	require.NoError(t, err)
+	require.Equal(t, "1", v)
+	require.Equal(t, 1, rev)
+
+	_, err = restored.Watch("a", false, 3)
+	require.ErrorIs(t, err, ErrCompacted)
+}
+
+// process applies an encoded entry the way the journal does.
+func process[K ~string, V any](m *Map[K, V], msg journal.Message) (any, error) {
+	return journal.Machine[Command[K, V]](m).Process(msg)
+}
+
+func TestMapTTL(t *testing.T) {
+	m := New[string, string]()
+	start := time.Unix(1000, 0)
+
+	process := func(c Command[string, string]) {
+		cmd, err := journal.Encode(journal.JSONCodec{}, c)
+		require.NoError(t, err)
+		_, err = process(m, journal.Message{Command: cmd})
+		require.NoError(t, err)
+	}
+
+	// a key written before the first tick expires relative to that tick
+	process(Command[string, string]{Key: "a", Value: "1", TTL: 2 * time.Second})
+	m.Tick(1, start)
+	process(Command[string, string]{Key: "b", Value: "2", TTL: 5 * time.Second})
+	process(Command[string, string]{Key: "c", Value: "3"})
+
+	ttl, ok := m.TTL("b")
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second, ttl)
+	_, ok = m.TTL("c")
+	require.False(t, ok)
+
+	m.Tick(4, start.Add(2*time.Second))
+	require.Equal(t, map[string]string{"b": "2", "c": "3"}, m.Dump())
+
+	// a clock going backwards does not move expiry
+	m.Tick(5, start.Add(time.Second))
+	ttl, _ = m.TTL("b")
+	require.Equal(t, 3*time.Second, ttl)
+
+	// overwriting without a TTL makes the key persistent
+	process(Command[string, string]{Key: "b", Value: "4"})
+	m.Tick(7, start.Add(time.Minute))
+	require.Equal(t, map[string]string{"b": "4", "c": "3"}, m.Dump())
+}
+
+func TestMapScan(t *testing.T) {
+	m := New[string, int]()
+	keys := []string{"services/b", "config/x", "services/a", "services/c", "services0", "a"}
+	for i, k := range keys {
+		m.m.Set(k, i)
+	}
+	m.m.Delete("services/c")
+
+	tests := []struct {
+		name string
+		got  []Pair[string, int]
+		want []string
+	}{
+		{
+			name: "full range",
+			got:  m.Range("", "", 0),
+			want: []string{"a", "config/x", "services/a", "services/b", "services0"},
+		},
+		{
+			name: "bounded range",
+			got:  m.Range("b", "services/b", 0),
+			want: []string{"config/x", "services/a"},
+		},
+		{
+			name: "limit",
+			got:  m.Range("config/", "", 2),
+			want: []string{"config/x", "services/a"},
+		},
+		{
+			name: "prefix",
+			got:  m.Prefix("services/"),
+			want: []string{"services/a", "services/b"},
+		},
+		{
+			name: "missing prefix",
+			got:  m.Prefix("queues/"),
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0, len(tt.got))
+			for _, p := range tt.got {
+				got = append(got, p.Key)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	require.Equal(t, "services0", PrefixEnd("services/"))
+	require.Equal(t, "b", PrefixEnd("a\xff"))
+	require.Equal(t, "", PrefixEnd("\xff\xff"))
+	require.Equal(t, "", PrefixEnd(""))
+}
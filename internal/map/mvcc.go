@@ -0,0 +1,92 @@
+package raftmap
+
+import "sort"
+
+// revisionRetention is how many journal entries of key history are kept
+// without an explicit compaction.
+const revisionRetention = 10000
+
+// revision is a single version of a key. Revisions are journal indexes, so
+// every replica assigns the same revision to the same write.
+type revision[V any] struct {
+	Index   int  `json:"index"`
+	Value   V    `json:"value,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// record appends the revisions produced by the events of the applied entry.
+func (m *Map[K, V]) record(events []Event[K, V]) {
+	for _, e := range events {
+		m.revs[e.Key] = append(m.revs[e.Key], revision[V]{
+			Index:   e.Index,
+			Value:   e.Value,
+			Deleted: e.Type == EventDelete,
+		})
+	}
+}
+
+// GetAt returns the value k had at revision rev and the revision that wrote
+// it. A negative rev reads the latest revision.
+func (m *Map[K, V]) GetAt(k K, rev int) (V, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var zero V
+	if rev >= 0 && rev < m.compactRev {
+		return zero, 0, ErrCompacted
+	}
+
+	revs := m.revs[k]
+	i := len(revs)
+	if rev >= 0 {
+		i = sort.Search(len(revs), func(i int) bool { return revs[i].Index > rev })
+	}
+	if i == 0 || revs[i-1].Deleted {
+		return zero, 0, ErrKeyNotFound
+	}
+	return revs[i-1].Value, revs[i-1].Index, nil
+}
+
+// CompactRevision returns the oldest revision that can still be read.
+func (m *Map[K, V]) CompactRevision() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.compactRev
+}
+
+// retain compacts the history that fell out of the retention window. It
+// compacts in steps of retention entries, so the cost of scanning the keys is
+// spread over as many applied entries. The window is counted in journal
+// indexes, so every replica compacts at the same index.
+func (m *Map[K, V]) retain() {
+	if m.retention <= 0 || m.index-m.compactRev < 2*m.retention {
+		return
+	}
+	_ = m.compact(m.index - m.retention)
+}
+
+// compact drops every revision that is not needed to read at rev or later.
+func (m *Map[K, V]) compact(rev int) error {
+	if rev > m.index {
+		return ErrInvalidRequest
+	}
+	if rev <= m.compactRev {
+		return nil
+	}
+
+	for k, revs := range m.revs {
+		i := sort.Search(len(revs), func(i int) bool { return revs[i].Index > rev })
+		// keep the revision visible at rev unless it is a deletion
+		keep := i
+		if i > 0 && !revs[i-1].Deleted {
+			keep = i - 1
+		}
+		if keep == len(revs) {
+			delete(m.revs, k)
+			continue
+		}
+		m.revs[k] = append(revs[:0:0], revs[keep:]...)
+	}
+	m.compactRev = rev
+	return nil
+}
@@ -0,0 +1,82 @@
+package raftmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestMapRevisions(t *testing.T) {
+	m := New[string, string]()
+
+	cmds := []Command[string, string]{
+		{Key: "a", Value: "1"},                    // 0
+		{Key: "b", Value: "1"},                    // 1
+		{Key: "a", Value: "2"},                    // 2
+		{Op: OpDelete, Key: "b"},                  // 3
+		{Op: OpDelete, Key: "missing"},            // 4, fails and writes nothing
+		{Key: "a", Value: "3"},                    // 5
+		{Op: OpCompact, Revision: 3},              // 6
+		{Op: OpCompact, Revision: 100},            // 7, beyond the applied index
+		{Op: OpPutIfAbsent, Key: "b", Value: "2"}, // 8
+	}
+	for i, c := range cmds {
+		cmd, err := journal.Encode(journal.JSONCodec{}, c)
+		require.NoError(t, err)
+		_, _ = process(m, journal.Message{Index: i, Command: cmd})
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		rev   int
+		value string
+		wrote int
+		err   error
+	}{
+		{name: "latest", key: "a", rev: -1, value: "3", wrote: 5},
+		{name: "at compaction point", key: "a", rev: 3, value: "2", wrote: 2},
+		{name: "between writes", key: "a", rev: 4, value: "2", wrote: 2},
+		{name: "deleted at revision", key: "b", rev: 4, err: ErrKeyNotFound},
+		{name: "recreated", key: "b", rev: 8, value: "2", wrote: 8},
+		{name: "compacted", key: "a", rev: 1, err: ErrCompacted},
+		{name: "never written", key: "c", rev: -1, err: ErrKeyNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, wrote, err := m.GetAt(tt.key, tt.rev)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.value, v)
+			require.Equal(t, tt.wrote, wrote)
+		})
+	}
+
+	require.Equal(t, 3, m.CompactRevision())
+	require.Len(t, m.revs["a"], 2)
+	require.Len(t, m.revs["b"], 1)
+}
+
+func TestMapRevisionRetention(t *testing.T) {
+	m := New[string, string]()
+	m.retention = 10
+
+	for i := range 25 {
+		cmd, err := journal.Encode(journal.JSONCodec{}, Command[string, string]{Key: "a", Value: string(rune('a' + i))})
+		require.NoError(t, err)
+		_, err = process(m, journal.Message{Index: i, Command: cmd})
+		require.NoError(t, err)
+	}
+
+	// compacted to 20-10 once the history reached twice the window
+	require.Equal(t, 10, m.CompactRevision())
+	require.Len(t, m.revs["a"], 15)
+	_, _, err := m.GetAt("a", 9)
+	require.ErrorIs(t, err, ErrCompacted)
+	v, wrote, err := m.GetAt("a", 10)
+	require.NoError(t, err)
+	require.Equal(t, "k", v)
+	require.Equal(t, 10, wrote)
+}
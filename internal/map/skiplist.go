@@ -0,0 +1,121 @@
+package raftmap
+
+import (
+	"cmp"
+	"iter"
+	"math/rand/v2"
+)
+
+const maxLevel = 16
+
+type skipNode[K cmp.Ordered, V any] struct {
+	key   K
+	value V
+	next  []*skipNode[K, V]
+}
+
+// skiplist is an ordered key space. Node levels are drawn from a fixed seed;
+// they only affect the shape of the list, never its contents.
+type skiplist[K cmp.Ordered, V any] struct {
+	head  *skipNode[K, V]
+	level int
+	len   int
+	rnd   *rand.Rand
+}
+
+func newSkiplist[K cmp.Ordered, V any]() *skiplist[K, V] {
+	return &skiplist[K, V]{
+		head:  &skipNode[K, V]{next: make([]*skipNode[K, V], maxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// seek returns the first node with key >= k and, for every level, the last
+// node before it.
+func (s *skiplist[K, V]) seek(k K) (*skipNode[K, V], [maxLevel]*skipNode[K, V]) {
+	var update [maxLevel]*skipNode[K, V]
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < k {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return x.next[0], update
+}
+
+func (s *skiplist[K, V]) Get(k K) (V, bool) {
+	x, _ := s.seek(k)
+	if x == nil || x.key != k {
+		var zero V
+		return zero, false
+	}
+	return x.value, true
+}
+
+func (s *skiplist[K, V]) Set(k K, v V) {
+	x, update := s.seek(k)
+	if x != nil && x.key == k {
+		x.value = v
+		return
+	}
+
+	level := 1
+	for level < maxLevel && s.rnd.IntN(4) == 0 {
+		level++
+	}
+	for i := s.level; i < level; i++ {
+		update[i] = s.head
+	}
+	s.level = max(s.level, level)
+
+	x = &skipNode[K, V]{key: k, value: v, next: make([]*skipNode[K, V], level)}
+	for i := range level {
+		x.next[i] = update[i].next[i]
+		update[i].next[i] = x
+	}
+	s.len++
+}
+
+func (s *skiplist[K, V]) Delete(k K) bool {
+	x, update := s.seek(k)
+	if x == nil || x.key != k {
+		return false
+	}
+	for i := range len(x.next) {
+		update[i].next[i] = x.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.len--
+	return true
+}
+
+func (s *skiplist[K, V]) Len() int {
+	return s.len
+}
+
+// From yields the entries with key >= k in ascending order.
+func (s *skiplist[K, V]) From(k K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		x, _ := s.seek(k)
+		for ; x != nil; x = x.next[0] {
+			if !yield(x.key, x.value) {
+				return
+			}
+		}
+	}
+}
+
+// All yields every entry in ascending key order.
+func (s *skiplist[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for x := s.head.next[0]; x != nil; x = x.next[0] {
+			if !yield(x.key, x.value) {
+				return
+			}
+		}
+	}
+}
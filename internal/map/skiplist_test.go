@@ -0,0 +1,38 @@
+package raftmap
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkiplistMatchesMap(t *testing.T) {
+	s := newSkiplist[string, int]()
+	want := map[string]int{}
+	rnd := rand.New(rand.NewPCG(3, 4))
+
+	for i := range 5000 {
+		k := strconv.Itoa(rnd.IntN(500))
+		if rnd.IntN(3) == 0 {
+			_, ok := want[k]
+			require.Equal(t, ok, s.Delete(k))
+			delete(want, k)
+			continue
+		}
+		s.Set(k, i)
+		want[k] = i
+	}
+
+	require.Equal(t, len(want), s.Len())
+
+	var keys []string
+	for k, v := range s.All() {
+		keys = append(keys, k)
+		require.Equal(t, want[k], v)
+	}
+	require.Equal(t, slices.Sorted(maps.Keys(want)), keys)
+}
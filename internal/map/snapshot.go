@@ -0,0 +1,67 @@
+package raftmap
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+type snapshot[K ~string, V any] struct {
+	Index      int                  `json:"index"`
+	Entries    []Pair[K, V]         `json:"entries"`
+	Expires    map[K]time.Duration  `json:"expires"`
+	Clock      journal.ElapsedClock `json:"clock"`
+	Revisions  map[K][]revision[V]  `json:"revisions"`
+	CompactRev int                  `json:"compact_revision"`
+}
+
+// Snapshot encodes the map state. Watch history is not included, so watches
+// can only resume from after the snapshot index.
+func (m *Map[K, V]) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := snapshot[K, V]{
+		Index:      m.index,
+		Entries:    make([]Pair[K, V], 0, m.m.Len()),
+		Expires:    m.expires,
+		Clock:      m.clock,
+		Revisions:  m.revs,
+		CompactRev: m.compactRev,
+	}
+	for k, v := range m.m.All() {
+		s.Entries = append(s.Entries, Pair[K, V]{Key: k, Value: v})
+	}
+	return json.Marshal(s)
+}
+
+// Restore replaces the map state with a snapshot.
+func (m *Map[K, V]) Restore(data []byte) error {
+	var s snapshot[K, V]
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.m = newSkiplist[K, V]()
+	for _, p := range s.Entries {
+		m.m.Set(p.Key, p.Value)
+	}
+	m.expires = s.Expires
+	if m.expires == nil {
+		m.expires = make(map[K]time.Duration)
+	}
+	m.revs = s.Revisions
+	if m.revs == nil {
+		m.revs = make(map[K][]revision[V])
+	}
+	m.clock = s.Clock
+	m.compactRev = s.CompactRev
+	m.index = s.Index
+	m.history = nil
+	m.compacted = s.Index
+	return nil
+}
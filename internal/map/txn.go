@@ -0,0 +1,128 @@
+package raftmap
+
+import (
+	"fmt"
+	"time"
+)
+
+type CompareOp string
+
+const (
+	CompareEqual    CompareOp = "equal"
+	CompareNotEqual CompareOp = "not_equal"
+	CompareExists   CompareOp = "exists"
+	CompareMissing  CompareOp = "missing"
+)
+
+// Compare is a transaction guard on a single key. Value is only used by the
+// equal and not_equal comparisons; a missing key never equals a value.
+type Compare[K comparable, V any] struct {
+	Key   K         `json:"key"`
+	Op    CompareOp `json:"op"`
+	Value V         `json:"value,omitempty"`
+}
+
+// Txn runs Then if every comparison holds and Else otherwise. The chosen
+// branch is applied as a whole or not at all.
+type Txn[K comparable, V any] struct {
+	Compare []Compare[K, V] `json:"compare"`
+	Then    []Command[K, V] `json:"then"`
+	Else    []Command[K, V] `json:"else"`
+}
+
+type TxnResult[V any] struct {
+	Succeeded bool        `json:"succeeded"`
+	Responses []Result[V] `json:"responses"`
+}
+
+// undo restores a key to the state it had before a transaction touched it.
+type undo[K ~string, V any] struct {
+	key         K
+	value       V
+	existed     bool
+	deadline    time.Duration
+	hasDeadline bool
+}
+
+func (m *Map[K, V]) txn(t *Txn[K, V]) (TxnResult[V], error) {
+	if t == nil {
+		return TxnResult[V]{}, ErrInvalidRequest
+	}
+
+	ok, err := m.compare(t.Compare)
+	if err != nil {
+		return TxnResult[V]{}, err
+	}
+
+	ops := t.Else
+	if ok {
+		ops = t.Then
+	}
+	for _, op := range ops {
+		if op.Op == OpTxn || op.Key == "" {
+			return TxnResult[V]{}, ErrInvalidRequest
+		}
+	}
+
+	res := TxnResult[V]{Succeeded: ok, Responses: make([]Result[V], 0, len(ops))}
+	undos := make([]undo[K, V], 0, len(ops))
+	for i, op := range ops {
+		u := undo[K, V]{key: op.Key}
+		u.value, u.existed = m.m.Get(op.Key)
+		u.deadline, u.hasDeadline = m.expires[op.Key]
+		undos = append(undos, u)
+
+		r, err := m.apply(op)
+		if err != nil {
+			m.rollback(undos)
+			return TxnResult[V]{Succeeded: ok}, fmt.Errorf("txn operation %d: %w", i, err)
+		}
+		res.Responses = append(res.Responses, r)
+	}
+
+	return res, nil
+}
+
+func (m *Map[K, V]) compare(cs []Compare[K, V]) (bool, error) {
+	for _, c := range cs {
+		if c.Key == "" {
+			return false, ErrInvalidRequest
+		}
+
+		v, ok := m.m.Get(c.Key)
+
+		var holds bool
+		switch c.Op {
+		case CompareEqual:
+			holds = ok && equal(v, c.Value)
+		case CompareNotEqual:
+			holds = !ok || !equal(v, c.Value)
+		case CompareExists:
+			holds = ok
+		case CompareMissing:
+			holds = !ok
+		default:
+			return false, ErrInvalidRequest
+		}
+		if !holds {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (m *Map[K, V]) rollback(undos []undo[K, V]) {
+	for i := len(undos) - 1; i >= 0; i-- {
+		u := undos[i]
+		if u.existed {
+			m.m.Set(u.key, u.value)
+		} else {
+			m.m.Delete(u.key)
+		}
+		if u.hasDeadline {
+			m.expires[u.key] = u.deadline
+		} else {
+			delete(m.expires, u.key)
+		}
+	}
+}
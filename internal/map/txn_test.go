@@ -0,0 +1,105 @@
+package raftmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestMapTxn(t *testing.T) {
+	type cmd = Command[string, string]
+	type cmp = Compare[string, string]
+
+	tests := []struct {
+		name      string
+		txn       Txn[string, string]
+		want      map[string]string
+		succeeded bool
+		err       error
+	}{
+		{
+			name: "then branch moves the lock and bumps the counter",
+			txn: Txn[string, string]{
+				Compare: []cmp{{Key: "lock", Op: CompareEqual, Value: "alice"}},
+				Then: []cmd{
+					{Op: OpPut, Key: "lock", Value: "bob"},
+					{Op: OpCAS, Key: "counter", Value: "2", Expected: "1"},
+				},
+				Else: []cmd{{Op: OpPut, Key: "failed", Value: "yes"}},
+			},
+			want:      map[string]string{"lock": "bob", "counter": "2"},
+			succeeded: true,
+		},
+		{
+			name: "else branch when a compare fails",
+			txn: Txn[string, string]{
+				Compare: []cmp{
+					{Key: "counter", Op: CompareExists},
+					{Key: "lock", Op: CompareNotEqual, Value: "alice"},
+				},
+				Then: []cmd{{Op: OpDelete, Key: "lock"}},
+				Else: []cmd{{Op: OpPutIfAbsent, Key: "queue", Value: "1"}},
+			},
+			want:      map[string]string{"lock": "alice", "counter": "1", "queue": "1"},
+			succeeded: false,
+		},
+		{
+			name: "missing compare",
+			txn: Txn[string, string]{
+				Compare: []cmp{{Key: "queue", Op: CompareMissing}},
+				Then:    []cmd{{Op: OpDelete, Key: "counter"}},
+			},
+			want:      map[string]string{"lock": "alice"},
+			succeeded: true,
+		},
+		{
+			name: "failed operation rolls the branch back",
+			txn: Txn[string, string]{
+				Then: []cmd{
+					{Op: OpPut, Key: "lock", Value: "bob"},
+					{Op: OpDelete, Key: "counter"},
+					{Op: OpPut, Key: "new", Value: "x"},
+					{Op: OpDelete, Key: "missing"},
+				},
+			},
+			want: map[string]string{"lock": "alice", "counter": "1"},
+			err:  ErrKeyNotFound,
+		},
+		{
+			name: "nested transactions are rejected",
+			txn: Txn[string, string]{
+				Then: []cmd{{Op: OpTxn, Txn: &Txn[string, string]{}}},
+			},
+			want: map[string]string{"lock": "alice", "counter": "1"},
+			err:  ErrInvalidRequest,
+		},
+		{
+			name: "unknown compare",
+			txn: Txn[string, string]{
+				Compare: []cmp{{Key: "lock", Op: "greater"}},
+			},
+			want: map[string]string{"lock": "alice", "counter": "1"},
+			err:  ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New[string, string]()
+			m.m.Set("lock", "alice")
+			m.m.Set("counter", "1")
+
+			c, err := journal.Encode(journal.GobCodec{}, cmd{Op: OpTxn, Txn: &tt.txn})
+			require.NoError(t, err)
+
+			res, err := process(m, journal.Message{Command: c})
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.want, m.Dump())
+			if tt.err == nil {
+				require.Equal(t, tt.succeeded, res.(TxnResult[string]).Succeeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package raftmap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrCompacted = errors.New("requested index is compacted")
+	ErrLagging   = errors.New("watcher fell too far behind")
+)
+
+const (
+	// historySize is how many events are kept for resuming watches.
+	historySize = 10000
+	// watchQueueSize is how many undelivered events a watcher may hold
+	// before it is dropped.
+	watchQueueSize = 10000
+)
+
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event is a change to a single key, stamped with the index of the journal
+// entry that caused it.
+type Event[K ~string, V any] struct {
+	Type  EventType `json:"type"`
+	Key   K         `json:"key"`
+	Value V         `json:"value,omitempty"`
+	Index int       `json:"index"`
+}
+
+// Watcher receives the events for a key or a key prefix in apply order.
+type Watcher[K ~string, V any] struct {
+	key    K
+	prefix bool
+
+	mu     sync.Mutex
+	queue  []Event[K, V]
+	err    error
+	notify chan struct{}
+	cancel func()
+}
+
+func (w *Watcher[K, V]) matches(k K) bool {
+	if w.prefix {
+		return strings.HasPrefix(string(k), string(w.key))
+	}
+	return k == w.key
+}
+
+func (w *Watcher[K, V]) push(events []Event[K, V]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+	for _, e := range events {
+		if w.matches(e.Key) {
+			w.queue = append(w.queue, e)
+		}
+	}
+	if len(w.queue) > watchQueueSize {
+		w.queue = nil
+		w.err = ErrLagging
+	}
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Next blocks until the next event is available or ctx is done.
+func (w *Watcher[K, V]) Next(ctx context.Context) (Event[K, V], error) {
+	for {
+		w.mu.Lock()
+		if len(w.queue) > 0 {
+			e := w.queue[0]
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+			return e, nil
+		}
+		err := w.err
+		w.mu.Unlock()
+
+		if err != nil {
+			return Event[K, V]{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Event[K, V]{}, ctx.Err()
+		case <-w.notify:
+		}
+	}
+}
+
+// Close unsubscribes the watcher.
+func (w *Watcher[K, V]) Close() {
+	w.cancel()
+}
+
+// Watch subscribes to changes of key, or of every key starting with it if
+// prefix is set. Retained events applied at index from or later are
+// delivered first.
+func (m *Map[K, V]) Watch(key K, prefix bool, from int) (*Watcher[K, V], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if from <= m.compacted {
+		return nil, ErrCompacted
+	}
+
+	w := &Watcher[K, V]{key: key, prefix: prefix, notify: make(chan struct{}, 1)}
+	w.cancel = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watchers, w)
+	}
+
+	for i, e := range m.history {
+		if e.Index >= from {
+			w.push(m.history[i:])
+			break
+		}
+	}
+	m.watchers[w] = struct{}{}
+
+	return w, nil
+}
+
+func (m *Map[K, V]) emit(e Event[K, V]) {
+	e.Index = m.index
+	m.pending = append(m.pending, e)
+}
+
+// publish records the events of the entry being applied as revisions and
+// delivers them to watchers. It runs under m.mu so watchers observe events in
+// apply order.
+func (m *Map[K, V]) publish() {
+	if len(m.pending) == 0 {
+		return
+	}
+
+	m.record(m.pending)
+
+	m.history = append(m.history, m.pending...)
+	if over := len(m.history) - historySize; over > 0 {
+		m.compacted = m.history[over-1].Index
+		m.history = append(m.history[:0:0], m.history[over:]...)
+	}
+
+	for w := range m.watchers {
+		w.push(m.pending)
+	}
+	m.pending = m.pending[:0]
+}
@@ -0,0 +1,72 @@
+package raftmap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestMapWatch(t *testing.T) {
+	m := New[string, string]()
+
+	index := 0
+	process := func(c Command[string, string]) {
+		cmd, err := journal.Encode(journal.JSONCodec{}, c)
+		require.NoError(t, err)
+		_, _ = process(m, journal.Message{Index: index, Command: cmd})
+		index++
+	}
+
+	process(Command[string, string]{Key: "services/a", Value: "1"})
+	process(Command[string, string]{Key: "config", Value: "x"})
+
+	w, err := m.Watch("services/", true, 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	process(Command[string, string]{Op: OpDelete, Key: "services/a"})
+	// a failed transaction emits nothing
+	process(Command[string, string]{Op: OpTxn, Txn: &Txn[string, string]{
+		Then: []Command[string, string]{
+			{Key: "services/b", Value: "2"},
+			{Op: OpDelete, Key: "missing"},
+		},
+	}})
+	process(Command[string, string]{Key: "services/c", Value: "3", TTL: time.Second})
+	m.Tick(index, time.Unix(0, 0))
+	m.Tick(index+1, time.Unix(1, 0))
+
+	want := []Event[string, string]{
+		{Type: EventPut, Key: "services/a", Value: "1", Index: 0},
+		{Type: EventDelete, Key: "services/a", Index: 2},
+		{Type: EventPut, Key: "services/c", Value: "3", Index: 4},
+		{Type: EventDelete, Key: "services/c", Index: 6},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, e := range want {
+		got, err := w.Next(ctx)
+		require.NoError(t, err)
+		require.Equal(t, e, got)
+	}
+
+	// resuming from a later index skips older events
+	w2, err := m.Watch("services/c", false, 5)
+	require.NoError(t, err)
+	defer w2.Close()
+
+	got, err := w2.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, want[3], got)
+
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	_, err = w2.Next(short)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+var (
+	ErrNotLeader      = errors.New("not leader")
+	ErrLostLeadership = errors.New("lost leadership")
+	ErrTimeout        = errors.New("request timed out")
+	ErrBusy           = errors.New("too many pending requests")
+)
+
+// Future is the pending outcome of a client request. It resolves once the
+// entry is applied on the node that accepted the request.
+type Future struct {
+	done   chan struct{}
+	once   sync.Once
+	result journal.ApplyResult
+	err    error
+
+	// leader is set when the request was proposed by this node as a leader
+	// and must fail if it steps down.
+	leader bool
+	forget func()
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{}), forget: func() {}}
+}
+
+func (f *Future) resolve(result journal.ApplyResult, err error) {
+	f.once.Do(func() {
+		f.result = result
+		f.err = err
+		close(f.done)
+	})
+}
+
+// Wait blocks until the request is applied or ctx is done.
+func (f *Future) Wait(ctx context.Context) (journal.ApplyResult, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		f.forget()
+		return journal.ApplyResult{}, ErrTimeout
+	}
+}
+
+// Done is closed when the future resolves.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (n *Node) track(id string, f *Future) {
+	n.pendingMu.Lock()
+	defer n.pendingMu.Unlock()
+
+	n.pending[id] = f
+	f.forget = func() {
+		n.pendingMu.Lock()
+		defer n.pendingMu.Unlock()
+		delete(n.pending, id)
+	}
+}
+
+func (n *Node) resolve(res journal.ApplyResult) {
+	n.pendingMu.Lock()
+	f, ok := n.pending[res.ID]
+	delete(n.pending, res.ID)
+	n.pendingMu.Unlock()
+
+	if ok {
+		f.resolve(res, res.Err)
+	}
+}
+
+// fail fails the pending request with the given id.
+func (n *Node) fail(id string, err error) {
+	n.resolve(journal.ApplyResult{ID: id, Err: err})
+}
+
+// failLeaderRequests fails the requests this node proposed while it was the
+// leader.
+func (n *Node) failLeaderRequests() {
+	n.pendingMu.Lock()
+	defer n.pendingMu.Unlock()
+
+	for id, f := range n.pending {
+		if f.leader {
+			delete(n.pending, id)
+			f.resolve(journal.ApplyResult{}, ErrLostLeadership)
+		}
+	}
+}
@@ -6,15 +6,15 @@ import (
 	"github.com/peyuaa/raft/internal/journal"
 )
 
-type entry = Entry[any]
+type entry = Entry[journal.Command]
 
 func (n *Node) requestVoteHandle(msg RequestVote, timeNow time.Time) {
-	to := n.Nodes[msg.GetFrom()]
+	to := msg.GetFrom()
 
 	if msg.GetTerm() <= n.Term { // if we don't need to update Term
-		to.Send(Vote{
-			From:        n.Id.String(),
-			To:          to.Id.String(),
+		n.send(to, Vote{
+			From:        n.Id,
+			To:          to,
 			Term:        n.Term,
 			VoteGranted: false,
 		})
@@ -31,13 +31,13 @@ func (n *Node) requestVoteHandle(msg RequestVote, timeNow time.Time) {
 	n.updateTerm(msg.GetTerm(), timeNow)
 
 	vote := Vote{
-		From:        n.Id.String(),
-		To:          to.Id.String(),
+		From:        n.Id,
+		To:          to,
 		Term:        n.Term,
 		VoteGranted: granted,
 	}
 
-	to.Send(vote)
+	n.send(to, vote)
 }
 
 func (n *Node) voteHandler(msg Vote) {
@@ -60,16 +60,10 @@ func (n *Node) voteHandler(msg Vote) {
 		n.Logger.Infof("a leader is %v", n.Id)
 		n.SetRole(Leader)
 		n.LeaderHeartBeatDeadline = time.Time{}
-		for _, node := range n.Nodes {
-			node.Send(AppendEntries{
-				From:        n.Id.String(),
-				To:          node.Id.String(),
-				Term:        n.Term,
-				PrevIndex:   n.Journal.PrevIndex(),
-				PrevTerm:    n.Journal.Get(n.Journal.PrevIndex()).Term,
-				CommitIndex: n.Journal.CommitIndex(),
-				Entries:     nil,
-			})
+		now := time.Now()
+		for _, peer := range n.Peers {
+			n.LastContact[peer] = now
+			n.sendProbe(peer)
 		}
 	}
 }
@@ -77,72 +71,78 @@ func (n *Node) voteHandler(msg Vote) {
 func (n *Node) appendEntriesHandler(msg AppendEntries, timeNow time.Time) {
 	n.updateTerm(msg.GetTerm(), timeNow)
 	n.Voted = false
+	n.setLeader(msg.GetFrom())
 
 	if n.Term < msg.Term {
-		n.Term = msg.Term
-	}
-	if msg.CommitIndex > n.Journal.CommitIndex() {
-		if len(msg.Entries) != 0 {
-			_ = n.Journal.Put(journal.Message{
-				Term:  msg.Term,
-				Index: msg.PrevIndex,
-				Data:  msg.Entries[0].Data,
-			})
-		}
-		if n.Journal.PrevIndex() > n.Journal.CommitIndex() {
-			if n.Journal.Commit() {
-				n.Nodes[msg.GetFrom()].Send(AppendEntriesResponse{
-					From:       n.Id.String(),
-					To:         msg.From,
-					Term:       n.Term,
-					Success:    true,
-					MatchIndex: n.Journal.CommitIndex(),
-				})
-				return
-			}
-
-		}
+		n.setTerm(msg.Term)
 	}
-	if msg.CommitIndex == n.Journal.CommitIndex() && n.Journal.Get(n.Journal.CommitIndex()).Term == msg.PrevTerm {
-		if len(msg.Entries) > 0 {
-			_ = n.Journal.Put(journal.Message{
-				Term:  msg.Term,
-				Index: n.Journal.Len(),
-				Data:  msg.Entries[0].Data,
-			})
-		}
-		n.Nodes[msg.GetFrom()].Send(AppendEntriesResponse{
-			From:       n.Id.String(),
+
+	// the entries only fit if the journal holds the one they follow, written
+	// in the same term; otherwise the leader has to go back further, to the
+	// end of the journal at most
+	if msg.PrevIndex >= n.Journal.Len() ||
+		msg.PrevIndex >= 0 && n.Journal.Get(msg.PrevIndex).Term != msg.PrevTerm {
+		n.send(msg.GetFrom(), AppendEntriesResponse{
+			From:       n.Id,
 			To:         msg.From,
 			Term:       n.Term,
-			Success:    true,
-			MatchIndex: n.Journal.PrevIndex(),
+			Success:    false,
+			MatchIndex: min(msg.PrevIndex, n.Journal.Len()),
 		})
 		return
 	}
-	n.Nodes[msg.GetFrom()].Send(AppendEntriesResponse{
-		From:       n.Id.String(),
+
+	index := msg.PrevIndex
+	for _, e := range msg.Entries {
+		index++
+		if index < n.Journal.Len() {
+			if n.Journal.Get(index).Term == e.Term {
+				continue
+			}
+			// an entry of another term at the same index was never
+			// committed, e.g. written by a leader cut off in a minority;
+			// drop it with everything after it
+			if err := n.Journal.Truncate(index); err != nil {
+				n.Logger.Errorf("%v: conflicting entry %d: %v", n.Id, index, err)
+				return
+			}
+		}
+		if err := n.Journal.Put(journal.Message{Term: e.Term, Index: index, Command: e.Data}); err != nil {
+			n.Logger.Errorf("%v: unable to put message in the Journal: %v", n.Id, err)
+			return
+		}
+	}
+
+	// only entries known to match the leader's are committed
+	for n.Journal.CommitIndex() < min(msg.CommitIndex, index) {
+		if !n.Journal.Commit() {
+			break
+		}
+	}
+
+	n.send(msg.GetFrom(), AppendEntriesResponse{
+		From:       n.Id,
 		To:         msg.From,
 		Term:       n.Term,
-		Success:    false,
-		MatchIndex: msg.PrevIndex,
+		Success:    true,
+		MatchIndex: index,
 	})
 }
 
 func (n *Node) appendEntriesResponseHandler(msg AppendEntriesResponse) {
 	if msg.Success {
 		if msg.MatchIndex < n.Journal.CommitIndex() {
-			n.Nodes[msg.GetFrom()].Send(AppendEntries{
-				From:        n.Id.String(),
+			n.send(msg.GetFrom(), AppendEntries{
+				From:        n.Id,
 				To:          msg.From,
 				Term:        n.Term,
-				PrevIndex:   msg.MatchIndex + 1,
-				PrevTerm:    n.Journal.Get(msg.MatchIndex + 1).Term,
+				PrevIndex:   msg.MatchIndex,
+				PrevTerm:    n.Journal.Get(msg.MatchIndex).Term,
 				CommitIndex: n.Journal.CommitIndex(),
 				Entries: []entry{
 					{
 						Term: n.Journal.Get(msg.MatchIndex + 1).Term,
-						Data: n.Journal.Get(msg.MatchIndex + 1).Data,
+						Data: n.Journal.Get(msg.MatchIndex + 1).Command,
 					},
 				},
 			})
@@ -159,9 +159,9 @@ func (n *Node) appendEntriesResponseHandler(msg AppendEntriesResponse) {
 					})
 
 					err := n.Journal.Put(journal.Message{
-						Term:  n.Term,
-						Index: n.Journal.Len(),
-						Data:  v,
+						Term:    n.Term,
+						Index:   n.Journal.Len(),
+						Command: v,
 					})
 					if err != nil {
 						n.Logger.Error("unable to put message in the Journal: %v", err)
@@ -175,8 +175,8 @@ func (n *Node) appendEntriesResponseHandler(msg AppendEntriesResponse) {
 					entries = n.VoteUpdate.Entry
 				}
 			}
-			n.Nodes[msg.GetFrom()].Send(AppendEntries{
-				From:        n.Id.String(),
+			n.send(msg.GetFrom(), AppendEntries{
+				From:        n.Id,
 				To:          msg.From,
 				Term:        n.Term,
 				PrevIndex:   msg.MatchIndex,
@@ -187,16 +187,17 @@ func (n *Node) appendEntriesResponseHandler(msg AppendEntriesResponse) {
 
 			return
 		}
-		if !n.VoteUpdate.Nodes[msg.GetFrom()] {
+		// a leader that has not replicated anything yet has no vote to count
+		if n.VoteUpdate.Nodes != nil && !n.VoteUpdate.Nodes[msg.GetFrom()] {
 			n.VoteUpdate.Nodes[msg.GetFrom()] = true
 			n.VoteUpdate.Count++
-			if n.VoteUpdate.Count >= (len(n.Nodes)+1)/2 {
+			if n.VoteUpdate.Count >= (len(n.Peers)+1)/2 {
 				n.VoteUpdate.Done = true
 				n.Journal.Commit()
 			}
 		}
-		n.Nodes[msg.GetFrom()].Send(AppendEntries{
-			From:        n.Id.String(),
+		n.send(msg.GetFrom(), AppendEntries{
+			From:        n.Id,
 			To:          msg.From,
 			Term:        n.Term,
 			PrevIndex:   msg.MatchIndex,
@@ -206,8 +207,14 @@ func (n *Node) appendEntriesResponseHandler(msg AppendEntriesResponse) {
 		})
 		return
 	}
-	n.Nodes[msg.GetFrom()].Send(AppendEntries{
-		From:        n.Id.String(),
+	// the peer has no matching entry at MatchIndex; send it that entry on
+	// top of the one before
+	if msg.MatchIndex > n.Journal.PrevIndex() {
+		n.sendProbe(msg.GetFrom())
+		return
+	}
+	n.send(msg.GetFrom(), AppendEntries{
+		From:        n.Id,
 		To:          msg.From,
 		Term:        n.Term,
 		PrevIndex:   msg.MatchIndex - 1,
@@ -215,9 +222,25 @@ func (n *Node) appendEntriesResponseHandler(msg AppendEntriesResponse) {
 		CommitIndex: n.Journal.CommitIndex(),
 		Entries: []entry{
 			{
-				Term: n.Journal.Get(msg.MatchIndex - 1).Term,
-				Data: n.Journal.Get(msg.MatchIndex - 1).Data,
+				Term: n.Journal.Get(msg.MatchIndex).Term,
+				Data: n.Journal.Get(msg.MatchIndex).Command,
 			},
 		},
 	})
 }
+
+// clientRequestHandler takes a request forwarded by a follower. A node that
+// is no longer the leader queues it to forward it again.
+func (n *Node) clientRequestHandler(msg ClientRequest) {
+	// the future of a forwarded request lives on the follower that accepted
+	// it, so a dropped request times out there
+	queue := n.WaitRequest
+	if n.Role == Leader {
+		queue = n.Updaters
+	}
+	select {
+	case queue <- msg.Command:
+	default:
+		n.Logger.Warnf("%v: dropped forwarded request %s", n.Id, msg.Command.ID)
+	}
+}
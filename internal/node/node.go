@@ -6,25 +6,28 @@ import (
 	"iter"
 	"math/rand/v2"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/google/uuid"
 
 	"github.com/peyuaa/raft/internal/journal"
-	raftmap "github.com/peyuaa/raft/internal/map"
 )
 
 type VoteUpdate struct {
-	Entry []Entry[any]
+	Entry []Entry[journal.Command]
 	Count int
 	Nodes map[ID]bool
 	Done  bool
 }
 
-type ID fmt.Stringer
+// ID identifies a node. Message senders and receivers are typed IDs, so a
+// malformed one is rejected when the message is decoded.
+type ID = uuid.UUID
 
-func NewVoteUpdate(entry []Entry[any]) VoteUpdate {
+func NewVoteUpdate(entry []Entry[journal.Command]) VoteUpdate {
 	return VoteUpdate{
 		Entry: entry,
 		Count: 0,
@@ -45,19 +48,36 @@ type Node struct {
 	Id                      ID
 	Term                    int
 	Role                    Role
-	Nodes                   map[ID]*Node
+	Peers                   []ID
+	Transport               Transport
+	Leader                  ID
 	Voted                   bool
 	CurrentVotes            int
 	VotePool                map[ID]bool
+	// peerSet holds the ids of Peers. Unlike VotePool it is not written once
+	// the node runs, so other goroutines may read it.
+	peerSet map[ID]struct{}
 	MaxDelta                time.Duration
 	LeaderHeartBeatDeadline time.Time
-	Messages                chan Message
-	Updaters                chan any
+	Updaters                chan journal.Command
 	IndexPool               map[ID]*time.Ticker
+	LastContact             map[ID]time.Time
 	NodePoolWait            map[ID]chan struct{}
 	VoteUpdate              VoteUpdate
-	WaitRequest             chan any
-	HasConnects             map[ID]bool
+	WaitRequest             chan journal.Command
+	LastTick                time.Time
+
+	// stateMu guards Role, Term and Leader. Only the goroutine running the
+	// node writes them and it reads them without locking; other goroutines
+	// read them through GetRole, GetTerm and GetLeader.
+	stateMu sync.RWMutex
+
+	pendingMu sync.Mutex
+	pending   map[string]*Future
+
+	// rejected counts messages addressed to another node or sent by a node
+	// outside the cluster
+	rejected atomic.Uint64
 
 	Journal *journal.Journal
 
@@ -71,33 +91,49 @@ type Node struct {
 const messageBufferSise = 1000
 const factor = 16
 
-func NewNode(nodes iter.Seq[*Node]) *Node {
+// tickInterval is how often a leader proposes its clock to the journal.
+const tickInterval = time.Second
+
+// probeInterval is how long a leader waits for a peer to answer before it
+// sends the peer a fresh AppendEntries. Replication is a request/response
+// exchange, so a lost message would otherwise stall the peer for good.
+const probeInterval = time.Second / 2
+
+// NewNode creates a node with the given id that talks to peers over
+// transport, applies committed entries to processor and encodes client
+// requests with codec.
+func NewNode(id ID, peers iter.Seq[ID], transport Transport, processor journal.Processor, codec journal.Codec) *Node {
 	n := &Node{
-		Id:                      uuid.New(),
-		Journal:                 journal.NewJournal(raftmap.New[any, any]()),
+		Id:                      id,
+		Journal:                 journal.NewJournal(processor, codec),
 		Term:                    -1,
 		Role:                    Follower,
-		Nodes:                   make(map[ID]*Node),
+		Transport:               transport,
 		VotePool:                make(map[ID]bool),
-		Messages:                make(chan Message, messageBufferSise),
-		Updaters:                make(chan any, messageBufferSise),
+		peerSet:                 make(map[ID]struct{}),
+		Updaters:                make(chan journal.Command, messageBufferSise),
 		Logger:                  log.New(os.Stdout),
 		MaxDelta:                randDelta(),
 		LeaderHeartBeatDeadline: time.Now().Add(time.Second + rand.N(5*time.Second)),
 		TurnOff:                 make(chan struct{}, 1),
 		NodePoolWait:            make(map[ID]chan struct{}, 1),
 		IndexPool:               make(map[ID]*time.Ticker),
+		LastContact:             make(map[ID]time.Time),
 		VoteUpdate:              VoteUpdate{Done: true},
-		WaitRequest:             make(chan any, messageBufferSise),
-		HasConnects:             map[ID]bool{},
+		WaitRequest:             make(chan journal.Command, messageBufferSise),
+		pending:                 make(map[string]*Future),
 	}
-	for node := range nodes {
-		n.Nodes[node.Id] = node
-		n.Nodes[node.Id] = node
-		n.HasConnects[node.Id] = true
-		node.HasConnects[n.Id] = true
-		n.IndexPool[node.Id] = time.NewTicker(time.Second / factor / 2)
-		n.VotePool[node.Id] = false
+	n.Journal.OnApply(func(res journal.ApplyResult) {
+		if res.Err != nil {
+			n.Logger.Errorf("%v: unable to apply entry %d: %v", n.Id, res.Index, res.Err)
+		}
+		n.resolve(res)
+	})
+	for peer := range peers {
+		n.Peers = append(n.Peers, peer)
+		n.peerSet[peer] = struct{}{}
+		n.IndexPool[peer] = time.NewTicker(time.Second / factor / 2)
+		n.VotePool[peer] = false
 	}
 	return n
 }
@@ -109,6 +145,7 @@ func (n *Node) Run(ctx context.Context) error {
 		}
 	}()
 	ticker := time.NewTicker(time.Second / factor)
+	go n.Journal.Run(ctx)
 
 loop:
 	for {
@@ -118,7 +155,7 @@ loop:
 		select {
 		case <-ctx.Done():
 			break loop
-		case msg := <-n.Messages:
+		case msg := <-n.Transport.Receive():
 			timestamp := time.Now()
 			n.Logger.Infof("%v: got message `%s`", n.Id, msg)
 
@@ -128,10 +165,12 @@ loop:
 
 			n.handleMessage(msg, timestamp)
 		case <-ticker.C:
+			now := time.Now()
+			n.forwardRequests()
 			if n.Role == Leader {
-				n.processUpdates()
+				n.proposeTick(now)
+				n.probePeers(now)
 			}
-			now := time.Now()
 
 			if n.Role == Candidate {
 				n.retryRequestVotes()
@@ -140,7 +179,7 @@ loop:
 
 			if n.LeaderDead(now) {
 				n.SetRole(Candidate)
-				go n.Election(now)
+				n.Election(now)
 				break
 			}
 		}
@@ -148,21 +187,75 @@ loop:
 	return nil
 }
 
-func (n *Node) processUpdates() {
-	for _, node := range n.Nodes {
-		select {
-		case v := <-node.WaitRequest:
-			n.Updaters <- v
-		default:
+// forwardRequests hands the client requests queued on this node to the
+// leader, or to its own journal once it is the leader. Requests stay queued
+// while no leader is known.
+func (n *Node) forwardRequests() {
+	if n.Role != Leader && n.Leader == uuid.Nil {
+		return
+	}
+	for range len(n.WaitRequest) {
+		cmd := <-n.WaitRequest
+		if n.Role == Leader {
+			// the node loop is what drains Updaters, so it must not block
+			select {
+			case n.Updaters <- cmd:
+			default:
+				n.fail(cmd.ID, ErrBusy)
+			}
+			continue
 		}
+		n.send(n.Leader, ClientRequest{
+			From:    n.Id,
+			To:      n.Leader,
+			Term:    n.Term,
+			Command: cmd,
+		})
 	}
 }
 
-func (n *Node) messageInvalid(msg Message) bool {
-	if msg.GetTo() != n.Id {
-		return true
+// proposeTick appends the leader clock to the journal when no client
+// requests are waiting, so expiry stays deterministic across replicas. An
+// idle leader with no pending deadline proposes nothing, so the journal does
+// not grow without client traffic.
+func (n *Node) proposeTick(now time.Time) {
+	if now.Sub(n.LastTick) < tickInterval || len(n.Updaters) > 0 || !n.Journal.HasDeadlines() {
+		return
 	}
-	if !n.HasConnects[msg.GetFrom()] {
+	n.LastTick = now
+	n.Updaters <- journal.NewTick(now)
+}
+
+// probePeers restarts replication to every peer that has not answered
+// within probeInterval.
+func (n *Node) probePeers(now time.Time) {
+	for _, peer := range n.Peers {
+		if now.Sub(n.LastContact[peer]) < probeInterval {
+			continue
+		}
+		n.LastContact[peer] = now
+		n.sendProbe(peer)
+	}
+}
+
+// sendProbe sends peer an AppendEntries without entries for the end of the
+// journal; the peer answers with how far it got.
+func (n *Node) sendProbe(peer ID) {
+	n.send(peer, AppendEntries{
+		From:        n.Id,
+		To:          peer,
+		Term:        n.Term,
+		PrevIndex:   n.Journal.PrevIndex(),
+		PrevTerm:    n.Journal.Get(n.Journal.PrevIndex()).Term,
+		CommitIndex: n.Journal.CommitIndex(),
+		Entries:     nil,
+	})
+}
+
+func (n *Node) messageInvalid(msg Message) bool {
+	if msg.GetTo() != n.Id || !n.isPeer(msg.GetFrom()) {
+		n.rejected.Add(1)
+		n.Logger.Warnf("%v: rejected %s from %v to %v", n.Id, msg.Type(), msg.GetFrom(), msg.GetTo())
 		return true
 	}
 	if msg.GetTerm() < n.Term {
@@ -184,8 +277,11 @@ func (n *Node) handleMessage(msg Message, time time.Time) {
 		if n.Role != Leader {
 			return
 		}
+		n.LastContact[msg.GetFrom()] = time
 		<-n.IndexPool[msg.GetFrom()].C
 		n.appendEntriesResponseHandler(v)
+	case ClientRequest:
+		n.clientRequestHandler(v)
 	}
 }
 
@@ -193,39 +289,86 @@ func (n *Node) LeaderDead(timeNow time.Time) bool {
 	return !n.LeaderHeartBeatDeadline.IsZero() && n.LeaderHeartBeatDeadline.Before(timeNow)
 }
 
-func (n *Node) Send(msg Message) {
-	n.Messages <- msg
+func (n *Node) send(to ID, msg Message) {
+	n.Transport.Send(to, msg)
 }
 
 func (n *Node) Election(timeNow time.Time) {
 	n.Logger.Infof("%v: election", n.Id)
+	n.setLeader(uuid.Nil)
 	n.CurrentVotes = 1
 	n.clearVotePool()
 	n.updateTerm(n.Term+1, timeNow)
-	go func() {
-		for _, node := range n.Nodes {
-			node.Send(RequestVote{
-				From: n.Id.String(),
-				To:   node.Id.String(),
-				Term: n.Term,
-			})
-		}
-	}()
+	for _, peer := range n.Peers {
+		n.send(peer, RequestVote{
+			From: n.Id,
+			To:   peer,
+			Term: n.Term,
+		})
+	}
 }
 
+// SetRole must only be called by the goroutine running the node.
 func (n *Node) SetRole(role Role) {
+	if n.Role == Leader && role != Leader {
+		n.failLeaderRequests()
+	}
+	// an entry still being replicated belongs to the term it was proposed
+	// in; a follower may truncate it, so a new leader starts afresh
+	if (n.Role == Leader) != (role == Leader) {
+		n.VoteUpdate = VoteUpdate{Done: true}
+	}
+	n.stateMu.Lock()
 	n.Role = role
+	n.stateMu.Unlock()
 }
 
-func (n *Node) Add(node *Node) error {
-	if _, ok := n.Nodes[node.Id]; ok {
-		return fmt.Errorf("node `%v` already exists", node.Id)
+func (n *Node) setTerm(term int) {
+	n.stateMu.Lock()
+	n.Term = term
+	n.stateMu.Unlock()
+}
+
+func (n *Node) setLeader(id ID) {
+	n.stateMu.Lock()
+	n.Leader = id
+	n.stateMu.Unlock()
+}
+
+// GetRole returns the role of the node; it is safe to call from any
+// goroutine.
+func (n *Node) GetRole() Role {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.Role
+}
+
+// GetTerm returns the current term of the node; it is safe to call from any
+// goroutine.
+func (n *Node) GetTerm() int {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.Term
+}
+
+// GetLeader returns the leader the node follows, uuid.Nil if it knows none;
+// it is safe to call from any goroutine.
+func (n *Node) GetLeader() ID {
+	n.stateMu.RLock()
+	defer n.stateMu.RUnlock()
+	return n.Leader
+}
+
+// Add makes peer a member of the cluster. It must be called before the node
+// runs.
+func (n *Node) Add(peer ID) error {
+	if n.isPeer(peer) {
+		return fmt.Errorf("node `%v` already exists", peer)
 	}
-	n.Nodes[node.Id] = node
-	n.VotePool[node.Id] = false
-	n.IndexPool[node.Id] = time.NewTicker(time.Second / factor)
-	n.HasConnects[node.Id] = true
-	node.HasConnects[n.Id] = true
+	n.Peers = append(n.Peers, peer)
+	n.peerSet[peer] = struct{}{}
+	n.VotePool[peer] = false
+	n.IndexPool[peer] = time.NewTicker(time.Second / factor)
 
 	return nil
 }
@@ -241,9 +384,9 @@ func (n *Node) retryRequestVotes() {
 		if n.Voted {
 			continue
 		}
-		n.Nodes[id].Send(RequestVote{
-			From: n.Id.String(),
-			To:   id.String(),
+		n.send(id, RequestVote{
+			From: n.Id,
+			To:   id,
 			Term: n.Term,
 		})
 	}
@@ -269,43 +412,129 @@ func (n *Node) updateTerm(term int, timeNow time.Time) {
 	if n.Term == term {
 		n.addDeadline2(timeNow)
 	}
-	n.Term = term
+	n.setTerm(term)
 	n.Voted = false
 	n.SetRole(Follower)
 	n.MaxDelta = randDelta()
 	n.LeaderHeartBeatDeadline = timeNow.Add(n.MaxDelta)
 }
 
-func (n *Node) Request(s any) {
-	if n.Role == Leader {
-		n.Updaters <- s
-		return
+// RequestTo proposes cmd to the state machine named machine, whose name fixes
+// the type of its commands. A leader appends it to its own journal, a
+// follower forwards it to the leader. The returned future resolves once the
+// entry is applied on this node. Nodes with a single state machine are
+// proposed to through cluster.Cluster.Request.
+func RequestTo[C any](n *Node, machine journal.Name[C], cmd C) *Future {
+	return n.request(string(machine), cmd)
+}
+
+func (n *Node) request(machine string, v any) *Future {
+	f := newFuture()
+
+	cmd, err := n.Journal.Encode(v)
+	if err != nil {
+		f.resolve(journal.ApplyResult{}, err)
+		return f
+	}
+	cmd.ID = uuid.NewString()
+	cmd.Machine = machine
+
+	var queue chan journal.Command
+	switch n.GetRole() {
+	case Leader:
+		f.leader = true
+		queue = n.Updaters
+	case Follower:
+		queue = n.WaitRequest
+	default:
+		f.resolve(journal.ApplyResult{}, ErrNotLeader)
+		return f
 	}
-	n.WaitRequest <- s
+
+	n.track(cmd.ID, f)
+	select {
+	case queue <- cmd:
+	default:
+		n.fail(cmd.ID, ErrBusy)
+	}
+	return f
 }
 
-func (n *Node) Disconnect(id ID) bool {
-	if _, ok := n.HasConnects[id]; !ok {
+// Disconnect cuts the link to a peer in the given direction if the
+// transport supports link control.
+func (n *Node) Disconnect(id ID, dir Direction) bool {
+	lc, ok := n.Transport.(LinkControl)
+	if !ok || !n.isPeer(id) {
 		return false
 	}
-	if _, ok := n.Nodes[id].HasConnects[n.Id]; !ok {
+	return lc.Disconnect(id, dir)
+}
+
+// Connect restores the link to a peer in the given direction if the
+// transport supports link control.
+func (n *Node) Connect(id ID, dir Direction) bool {
+	lc, ok := n.Transport.(LinkControl)
+	if !ok || !n.isPeer(id) {
 		return false
 	}
-	n.HasConnects[id] = false
-	n.Nodes[id].HasConnects[n.Id] = false
+	return lc.Connect(id, dir)
+}
 
-	return true
+// Connected reports whether messages can flow to or from a peer, or both
+// ways for Both.
+func (n *Node) Connected(id ID, dir Direction) bool {
+	lc, ok := n.Transport.(LinkControl)
+	if !ok {
+		return n.isPeer(id)
+	}
+	return n.isPeer(id) && lc.Connected(id, dir)
 }
 
-func (n *Node) Connect(id ID) bool {
-	if _, ok := n.HasConnects[id]; !ok {
+// SetFault degrades the link to a peer if the transport supports fault
+// injection. The zero Fault restores a healthy link.
+func (n *Node) SetFault(id ID, f Fault) bool {
+	fi, ok := n.Transport.(FaultInjector)
+	if !ok || !n.isPeer(id) {
 		return false
 	}
-	if _, ok := n.Nodes[id].HasConnects[n.Id]; !ok {
-		return false
+	return fi.SetFault(id, f)
+}
+
+// Fault returns the fault policy of the link to a peer.
+func (n *Node) Fault(id ID) Fault {
+	fi, ok := n.Transport.(FaultInjector)
+	if !ok || !n.isPeer(id) {
+		return Fault{}
 	}
-	n.HasConnects[id] = true
-	n.Nodes[id].HasConnects[n.Id] = true
+	return fi.Fault(id)
+}
+
+// SendStats returns the send queue counters of every peer, or nil if the
+// transport does not queue messages.
+func (n *Node) SendStats() map[ID]SendStats {
+	sq, ok := n.Transport.(SendQueues)
+	if !ok {
+		return nil
+	}
+	res := make(map[ID]SendStats, len(n.Peers))
+	for _, peer := range n.Peers {
+		res[peer] = sq.SendStats(peer)
+	}
+	return res
+}
+
+// Rejected returns how many messages this node refused: those its transport
+// could not decode and those not meant for it.
+func (n *Node) Rejected() uint64 {
+	rejected := n.rejected.Load()
+	if r, ok := n.Transport.(Rejecter); ok {
+		rejected += r.Rejected()
+	}
+	return rejected
+}
 
-	return true
+// isPeer is safe to call from any goroutine.
+func (n *Node) isPeer(id ID) bool {
+	_, ok := n.peerSet[id]
+	return ok
 }
@@ -0,0 +1,278 @@
+package node
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+type nopTransport struct{}
+
+func (nopTransport) Send(ID, Message)        {}
+func (nopTransport) Receive() <-chan Message { return nil }
+
+// timerProcessor is a Clock that waits for ticks only while pending is set.
+type timerProcessor struct {
+	pending bool
+}
+
+func (p *timerProcessor) Process(journal.Message) (any, error) { return nil, nil }
+func (p *timerProcessor) Snapshot() ([]byte, error)            { return nil, nil }
+func (p *timerProcessor) Restore([]byte) error                 { return nil }
+func (p *timerProcessor) Tick(int, time.Time)                  {}
+func (p *timerProcessor) HasDeadlines() bool                   { return p.pending }
+
+func TestProposeTick(t *testing.T) {
+	proc := &timerProcessor{}
+	n := NewNode(uuid.New(), slices.Values([]ID{uuid.New()}), nopTransport{}, proc, journal.JSONCodec{})
+	n.SetRole(Leader)
+
+	// an idle leader with nothing to expire leaves the journal alone
+	now := time.Now()
+	n.proposeTick(now)
+	require.Empty(t, n.Updaters)
+
+	proc.pending = true
+	n.proposeTick(now)
+	require.Len(t, n.Updaters, 1)
+	_, ok := (<-n.Updaters).Tick()
+	require.True(t, ok)
+
+	// at most one tick per interval
+	n.proposeTick(now.Add(tickInterval / 2))
+	require.Empty(t, n.Updaters)
+	n.proposeTick(now.Add(tickInterval))
+	require.Len(t, n.Updaters, 1)
+}
+
+type recordingTransport struct {
+	sent []Message
+}
+
+func (t *recordingTransport) Send(_ ID, msg Message)  { t.sent = append(t.sent, msg) }
+func (t *recordingTransport) Receive() <-chan Message { return nil }
+
+// TestAppendEntriesResponseWithoutVote answers a fresh leader with a match
+// beyond its commit index before it has proposed anything of its own, so
+// there is no vote being counted.
+func TestAppendEntriesResponseWithoutVote(t *testing.T) {
+	peer := uuid.New()
+	transport := &recordingTransport{}
+	n := NewNode(uuid.New(), slices.Values([]ID{peer}), transport, &timerProcessor{}, journal.JSONCodec{})
+	n.SetRole(Leader)
+	require.NoError(t, n.Journal.Put(journal.Message{Term: 0, Index: 0, Command: journal.NewTick(time.Now())}))
+
+	require.NotPanics(t, func() {
+		n.appendEntriesResponseHandler(AppendEntriesResponse{From: peer, To: n.Id, Success: true, MatchIndex: 0})
+	})
+	require.Equal(t, -1, n.Journal.CommitIndex())
+	require.Len(t, transport.sent, 1)
+	require.IsType(t, AppendEntries{}, transport.sent[0])
+}
+
+// TestRequestBusy fills the leader's request buffer. Neither a client nor a
+// forwarded request may block the caller, which for forwarded requests is
+// the node loop that drains the buffer.
+func TestRequestBusy(t *testing.T) {
+	peer := uuid.New()
+	n := NewNode(uuid.New(), slices.Values([]ID{peer}), nopTransport{}, &timerProcessor{}, journal.JSONCodec{})
+	n.SetRole(Leader)
+	for range cap(n.Updaters) {
+		n.Updaters <- journal.NewTick(time.Now())
+	}
+
+	_, err := n.request("", "x").Wait(context.Background())
+	require.ErrorIs(t, err, ErrBusy)
+	require.Empty(t, n.pending)
+
+	n.clientRequestHandler(ClientRequest{From: peer, To: n.Id, Command: journal.NewTick(time.Now())})
+	require.Len(t, n.Updaters, cap(n.Updaters))
+}
+
+// newFollower returns a follower whose journal holds entries of the given
+// terms, the first committed ones of them committed.
+func newFollower(t *testing.T, leader ID, committed int, terms ...int) (*Node, *recordingTransport) {
+	transport := &recordingTransport{}
+	n := NewNode(uuid.New(), slices.Values([]ID{leader}), transport, &timerProcessor{}, journal.JSONCodec{})
+	for i, term := range terms {
+		require.NoError(t, n.Journal.Put(journal.Message{Term: term, Index: i, Command: journal.Command{ID: strconv.Itoa(i)}}))
+	}
+	for range committed {
+		require.True(t, n.Journal.Commit())
+	}
+	return n, transport
+}
+
+func lastResponse(t *testing.T, transport *recordingTransport) AppendEntriesResponse {
+	require.NotEmpty(t, transport.sent)
+	res, ok := transport.sent[len(transport.sent)-1].(AppendEntriesResponse)
+	require.True(t, ok)
+	return res
+}
+
+func TestAppendEntriesConflict(t *testing.T) {
+	leader := uuid.New()
+	cmd := journal.Command{ID: "new"}
+
+	t.Run("conflicting entry", func(t *testing.T) {
+		// entry 2 was written by an older leader that never committed it
+		n, transport := newFollower(t, leader, 2, 1, 1, 2, 2)
+		n.appendEntriesHandler(AppendEntries{From: leader, To: n.Id, Term: 3, PrevIndex: 1, PrevTerm: 1, CommitIndex: 2,
+			Entries: []entry{{Term: 3, Data: cmd}}}, time.Now())
+
+		require.Equal(t, AppendEntriesResponse{From: n.Id, To: leader, Term: 3, Success: true, MatchIndex: 2}, lastResponse(t, transport))
+		require.Equal(t, 3, n.Journal.Len())
+		require.Equal(t, 3, n.Journal.Get(2).Term)
+		require.Equal(t, "new", n.Journal.Get(2).Command.ID)
+		require.Equal(t, 2, n.Journal.CommitIndex())
+	})
+
+	t.Run("matching entries are kept", func(t *testing.T) {
+		n, transport := newFollower(t, leader, 0, 1, 1, 1)
+		n.appendEntriesHandler(AppendEntries{From: leader, To: n.Id, Term: 1, PrevIndex: 0, PrevTerm: 1, CommitIndex: 2,
+			Entries: []entry{{Term: 1, Data: cmd}}}, time.Now())
+
+		require.Equal(t, 1, lastResponse(t, transport).MatchIndex)
+		require.Equal(t, 3, n.Journal.Len())
+		require.Equal(t, "1", n.Journal.Get(1).Command.ID)
+		// entry 2 is not known to match the leader's yet
+		require.Equal(t, 1, n.Journal.CommitIndex())
+	})
+
+	t.Run("previous entry of another term", func(t *testing.T) {
+		n, transport := newFollower(t, leader, 0, 1, 1, 2)
+		n.appendEntriesHandler(AppendEntries{From: leader, To: n.Id, Term: 3, PrevIndex: 2, PrevTerm: 3, CommitIndex: 2}, time.Now())
+
+		res := lastResponse(t, transport)
+		require.False(t, res.Success)
+		require.Equal(t, 2, res.MatchIndex)
+		require.Equal(t, 3, n.Journal.Len())
+		require.Equal(t, -1, n.Journal.CommitIndex())
+	})
+
+	t.Run("missing previous entry", func(t *testing.T) {
+		n, transport := newFollower(t, leader, 0, 1)
+		n.appendEntriesHandler(AppendEntries{From: leader, To: n.Id, Term: 1, PrevIndex: 5, PrevTerm: 1, CommitIndex: 5}, time.Now())
+
+		res := lastResponse(t, transport)
+		require.False(t, res.Success)
+		require.Equal(t, 1, res.MatchIndex)
+	})
+
+	t.Run("empty journal", func(t *testing.T) {
+		n, transport := newFollower(t, leader, 0)
+		n.appendEntriesHandler(AppendEntries{From: leader, To: n.Id, Term: 1, PrevIndex: -1, CommitIndex: 0,
+			Entries: []entry{{Term: 1, Data: cmd}}}, time.Now())
+
+		require.Equal(t, 0, lastResponse(t, transport).MatchIndex)
+		require.Equal(t, 0, n.Journal.CommitIndex())
+	})
+}
+
+// TestAppendEntriesBackoff walks the leader back to the entry a peer is
+// missing.
+func TestAppendEntriesBackoff(t *testing.T) {
+	peer := uuid.New()
+	n, transport := newFollower(t, peer, 2, 1, 1, 2)
+	n.SetRole(Leader)
+	n.setTerm(2)
+
+	n.appendEntriesResponseHandler(AppendEntriesResponse{From: peer, To: n.Id, Term: 2, Success: false, MatchIndex: 2})
+	msg, ok := transport.sent[len(transport.sent)-1].(AppendEntries)
+	require.True(t, ok)
+	require.Equal(t, 1, msg.PrevIndex)
+	require.Equal(t, 1, msg.PrevTerm)
+	require.Equal(t, []entry{{Term: 2, Data: journal.Command{ID: "2"}}}, msg.Entries)
+
+	// an answer beyond the journal restarts from its end
+	n.appendEntriesResponseHandler(AppendEntriesResponse{From: peer, To: n.Id, Term: 2, Success: false, MatchIndex: 7})
+	msg, ok = transport.sent[len(transport.sent)-1].(AppendEntries)
+	require.True(t, ok)
+	require.Equal(t, 2, msg.PrevIndex)
+	require.Empty(t, msg.Entries)
+}
+
+func TestProbePeers(t *testing.T) {
+	quiet, recent := uuid.New(), uuid.New()
+	transport := &recordingTransport{}
+	n := NewNode(uuid.New(), slices.Values([]ID{quiet, recent}), transport, &timerProcessor{}, journal.JSONCodec{})
+	n.SetRole(Leader)
+	n.setTerm(1)
+	require.NoError(t, n.Journal.Put(journal.Message{Term: 1, Index: 0}))
+
+	now := time.Now()
+	n.LastContact[quiet] = now.Add(-probeInterval)
+	n.LastContact[recent] = now
+	n.probePeers(now)
+
+	require.Equal(t, []Message{AppendEntries{From: n.Id, To: quiet, Term: 1, PrevIndex: 0, PrevTerm: 1, CommitIndex: -1}}, transport.sent)
+	require.Equal(t, now, n.LastContact[quiet])
+
+	// a probe is not repeated before the peer had time to answer
+	n.probePeers(now.Add(probeInterval / 2))
+	require.Len(t, transport.sent, 1)
+}
+
+// TestLeaderReelected deposes a leader with an entry still being replicated,
+// lets the new leader overwrite that entry and elects the node again. It must
+// replicate new requests in its own term rather than the dropped entry.
+func TestLeaderReelected(t *testing.T) {
+	peer := uuid.New()
+	transport := &recordingTransport{}
+	n := NewNode(uuid.New(), slices.Values([]ID{peer}), transport, &timerProcessor{}, journal.JSONCodec{})
+	n.setTerm(1)
+	n.SetRole(Leader)
+
+	n.Updaters <- journal.Command{ID: "minority"}
+	n.appendEntriesResponseHandler(AppendEntriesResponse{From: peer, To: n.Id, Term: 1, Success: true, MatchIndex: -1})
+	require.False(t, n.VoteUpdate.Done)
+	require.Equal(t, "minority", n.Journal.Get(0).Command.ID)
+
+	n.appendEntriesHandler(AppendEntries{From: peer, To: n.Id, Term: 2, PrevIndex: -1, CommitIndex: 0,
+		Entries: []entry{{Term: 2, Data: journal.Command{ID: "majority"}}}}, time.Now())
+	require.Equal(t, Follower, n.Role)
+	require.Equal(t, "majority", n.Journal.Get(0).Command.ID)
+	require.Equal(t, 0, n.Journal.CommitIndex())
+
+	n.setTerm(3)
+	n.SetRole(Leader)
+	n.Updaters <- journal.Command{ID: "new"}
+	n.appendEntriesResponseHandler(AppendEntriesResponse{From: peer, To: n.Id, Term: 3, Success: true, MatchIndex: 0})
+
+	msg, ok := transport.sent[len(transport.sent)-1].(AppendEntries)
+	require.True(t, ok)
+	require.Equal(t, []entry{{Term: 3, Data: journal.Command{ID: "new"}}}, msg.Entries)
+	require.Empty(t, n.Updaters)
+	require.Equal(t, 2, n.Journal.Len())
+}
+
+// TestConnectedDuringElection asks for a link's state from another
+// goroutine, as the HTTP handlers do, while the node counts votes.
+func TestConnectedDuringElection(t *testing.T) {
+	peer := uuid.New()
+	n := NewNode(uuid.New(), slices.Values([]ID{peer, uuid.New()}), nopTransport{}, &timerProcessor{}, journal.JSONCodec{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 1000 {
+			if !n.Connected(peer, Both) {
+				t.Error("peer is not connected")
+				return
+			}
+		}
+	}()
+	for range 1000 {
+		n.SetRole(Candidate)
+		n.Election(time.Now())
+		n.voteHandler(Vote{From: peer, To: n.Id, Term: n.Term})
+	}
+	<-done
+}
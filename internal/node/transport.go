@@ -0,0 +1,88 @@
+package node
+
+import (
+	"fmt"
+	"time"
+)
+
+// Transport carries messages between nodes. Each node owns one endpoint:
+// Send addresses a peer by ID and Receive streams the messages addressed to
+// this node.
+type Transport interface {
+	Send(to ID, msg Message)
+	Receive() <-chan Message
+}
+
+// Direction selects which way of a link to a peer is affected: Outbound
+// carries messages to the peer, Inbound carries messages from it.
+type Direction int
+
+const (
+	Both Direction = iota
+	Outbound
+	Inbound
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Both:
+		return "both"
+	case Outbound:
+		return "outbound"
+	case Inbound:
+		return "inbound"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// LinkControl is implemented by transports whose links to a peer can be cut
+// and restored, for rehearsing network partitions. A disconnected direction
+// drops the messages sent that way; Connected with Both reports whether
+// messages flow both ways.
+type LinkControl interface {
+	Connect(peer ID, dir Direction) bool
+	Disconnect(peer ID, dir Direction) bool
+	Connected(peer ID, dir Direction) bool
+}
+
+// Fault describes how a link misbehaves. Every message is delayed by Delay
+// plus a uniform random jitter in [-Jitter, Jitter] and a random extra delay
+// in [0, Reorder), so messages sent within the reorder window may overtake
+// each other. Drop and Duplicate are probabilities in [0, 1]. The zero value
+// is a healthy link.
+type Fault struct {
+	Drop      float64
+	Duplicate float64
+	Delay     time.Duration
+	Jitter    time.Duration
+	Reorder   time.Duration
+}
+
+// FaultInjector is implemented by transports that can degrade a link to a
+// peer, for rehearsing lossy networks. Like LinkControl it applies to both
+// directions of the link.
+type FaultInjector interface {
+	SetFault(peer ID, f Fault) bool
+	Fault(peer ID) Fault
+}
+
+// SendStats counts the messages a transport queued for one peer. Queued and
+// Dropped are totals since the queue was created, Pending is the number of
+// messages waiting now.
+type SendStats struct {
+	Queued  uint64
+	Dropped uint64
+	Pending int
+}
+
+// SendQueues is implemented by transports that queue outgoing messages per
+// peer instead of blocking the sender.
+type SendQueues interface {
+	SendStats(peer ID) SendStats
+}
+
+// Rejecter is implemented by transports that decode messages from the
+// network. Rejected counts the messages dropped because they were malformed.
+type Rejecter interface {
+	Rejected() uint64
+}
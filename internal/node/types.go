@@ -3,35 +3,35 @@ package node
 import (
 	"fmt"
 
-	"github.com/google/uuid"
+	"github.com/peyuaa/raft/internal/journal"
 )
 
 type Message interface {
 	String() string
 	GetTerm() int
-	GetFrom() uuid.UUID
-	GetTo() uuid.UUID
+	GetFrom() ID
+	GetTo() ID
 	Type() string
 }
 
 var _ Message = &RequestVote{}
 
 type RequestVote struct {
-	From string `json:"from"`
-	To   string `json:"to"`
-	Term int    `json:"term"`
+	From ID  `json:"from"`
+	To   ID  `json:"to"`
+	Term int `json:"term"`
 }
 
 func (r RequestVote) GetTerm() int {
 	return r.Term
 }
 
-func (r RequestVote) GetFrom() uuid.UUID {
-	return uuid.MustParse(r.From)
+func (r RequestVote) GetFrom() ID {
+	return r.From
 }
 
-func (r RequestVote) GetTo() uuid.UUID {
-	return uuid.MustParse(r.To)
+func (r RequestVote) GetTo() ID {
+	return r.To
 }
 
 func (r RequestVote) Type() string {
@@ -45,22 +45,22 @@ func (r RequestVote) String() string {
 var _ Message = Vote{}
 
 type Vote struct {
-	From        string `json:"from"`
-	To          string `json:"to"`
-	Term        int    `json:"term"`
-	VoteGranted bool   `json:"vote_granted"`
+	From        ID   `json:"from"`
+	To          ID   `json:"to"`
+	Term        int  `json:"term"`
+	VoteGranted bool `json:"vote_granted"`
 }
 
 func (v Vote) GetTerm() int {
 	return v.Term
 }
 
-func (v Vote) GetFrom() uuid.UUID {
-	return uuid.MustParse(v.From)
+func (v Vote) GetFrom() ID {
+	return v.From
 }
 
-func (v Vote) GetTo() uuid.UUID {
-	return uuid.MustParse(v.To)
+func (v Vote) GetTo() ID {
+	return v.To
 }
 
 func (v Vote) Type() string {
@@ -74,21 +74,21 @@ func (v Vote) String() string {
 var _ Message = HeartBeat{}
 
 type HeartBeat struct {
-	From string `json:"from"`
-	To   string `json:"to"`
-	Term int    `json:"term"`
+	From ID  `json:"from"`
+	To   ID  `json:"to"`
+	Term int `json:"term"`
 }
 
 func (v HeartBeat) GetTerm() int {
 	return v.Term
 }
 
-func (v HeartBeat) GetFrom() uuid.UUID {
-	return uuid.MustParse(v.From)
+func (v HeartBeat) GetFrom() ID {
+	return v.From
 }
 
-func (v HeartBeat) GetTo() uuid.UUID {
-	return uuid.MustParse(v.To)
+func (v HeartBeat) GetTo() ID {
+	return v.To
 }
 
 func (v HeartBeat) Type() string {
@@ -105,25 +105,25 @@ type Entry[T any] struct {
 }
 
 type AppendEntries struct {
-	From        string       `json:"from"`
-	To          string       `json:"to"`
-	Term        int          `json:"term"`
-	PrevIndex   int          `json:"prev_index"`
-	PrevTerm    int          `json:"prev_term"`
-	CommitIndex int          `json:"commit_index"`
-	Entries     []Entry[any] `json:"entries"`
+	From        ID                       `json:"from"`
+	To          ID                       `json:"to"`
+	Term        int                      `json:"term"`
+	PrevIndex   int                      `json:"prev_index"`
+	PrevTerm    int                      `json:"prev_term"`
+	CommitIndex int                      `json:"commit_index"`
+	Entries     []Entry[journal.Command] `json:"entries"`
 }
 
 func (v AppendEntries) GetTerm() int {
 	return v.Term
 }
 
-func (v AppendEntries) GetFrom() uuid.UUID {
-	return uuid.MustParse(v.From)
+func (v AppendEntries) GetFrom() ID {
+	return v.From
 }
 
-func (v AppendEntries) GetTo() uuid.UUID {
-	return uuid.MustParse(v.To)
+func (v AppendEntries) GetTo() ID {
+	return v.To
 }
 
 func (v AppendEntries) Type() string {
@@ -135,23 +135,23 @@ func (v AppendEntries) String() string {
 }
 
 type AppendEntriesResponse struct {
-	From       string `json:"from"`
-	To         string `json:"to"`
-	Term       int    `json:"term"`
-	Success    bool   `json:"success"`
-	MatchIndex int    `json:"match_index"`
+	From       ID   `json:"from"`
+	To         ID   `json:"to"`
+	Term       int  `json:"term"`
+	Success    bool `json:"success"`
+	MatchIndex int  `json:"match_index"`
 }
 
 func (v AppendEntriesResponse) GetTerm() int {
 	return v.Term
 }
 
-func (v AppendEntriesResponse) GetFrom() uuid.UUID {
-	return uuid.MustParse(v.From)
+func (v AppendEntriesResponse) GetFrom() ID {
+	return v.From
 }
 
-func (v AppendEntriesResponse) GetTo() uuid.UUID {
-	return uuid.MustParse(v.To)
+func (v AppendEntriesResponse) GetTo() ID {
+	return v.To
 }
 
 func (v AppendEntriesResponse) Type() string {
@@ -161,3 +161,31 @@ func (v AppendEntriesResponse) Type() string {
 func (v AppendEntriesResponse) String() string {
 	return fmt.Sprintf("AppendEntriesResponse{from %s to %s}, Term is %d, Success=%t, Match=%d", v.From, v.To, v.Term, v.Success, v.MatchIndex)
 }
+
+// ClientRequest carries a client command from a follower to the leader.
+type ClientRequest struct {
+	From    ID              `json:"from"`
+	To      ID              `json:"to"`
+	Term    int             `json:"term"`
+	Command journal.Command `json:"command"`
+}
+
+func (v ClientRequest) GetTerm() int {
+	return v.Term
+}
+
+func (v ClientRequest) GetFrom() ID {
+	return v.From
+}
+
+func (v ClientRequest) GetTo() ID {
+	return v.To
+}
+
+func (v ClientRequest) Type() string {
+	return "ClientRequest"
+}
+
+func (v ClientRequest) String() string {
+	return fmt.Sprintf("ClientRequest{from %s to %s}, Term is %d, Command=%s", v.From, v.To, v.Term, v.Command.ID)
+}
@@ -0,0 +1,83 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidMessage is returned for messages that cannot be decoded or lack
+// a sender or receiver.
+var ErrInvalidMessage = errors.New("invalid message")
+
+// envelope is the wire form of a Message: its type name and the message
+// itself.
+type envelope struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MarshalMessage encodes msg for transports that cross process boundaries.
+func MarshalMessage(msg Message) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Type: msg.Type(), Data: data})
+}
+
+// UnmarshalMessage decodes a message encoded by MarshalMessage. Sender and
+// receiver IDs are validated here, so the rest of the node can trust them.
+func UnmarshalMessage(data []byte) (Message, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	var msg Message
+	var err error
+	switch env.Type {
+	case "RequestVote":
+		msg, err = decode[RequestVote](env.Data)
+	case "Vote":
+		msg, err = decode[Vote](env.Data)
+	case "HeartBeat":
+		msg, err = decode[HeartBeat](env.Data)
+	case "AppendEntries":
+		msg, err = decode[AppendEntries](env.Data)
+	case "AppendEntriesResponse":
+		msg, err = decode[AppendEntriesResponse](env.Data)
+	case "ClientRequest":
+		msg, err = decode[ClientRequest](env.Data)
+	default:
+		return nil, fmt.Errorf("%w: unknown message type `%s`", ErrInvalidMessage, env.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if err := Validate(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Validate checks that msg names both its sender and its receiver.
+func Validate(msg Message) error {
+	if msg.GetFrom() == uuid.Nil {
+		return fmt.Errorf("%w: %s without sender", ErrInvalidMessage, msg.Type())
+	}
+	if msg.GetTo() == uuid.Nil {
+		return fmt.Errorf("%w: %s without receiver", ErrInvalidMessage, msg.Type())
+	}
+	return nil
+}
+
+func decode[M Message](data []byte) (Message, error) {
+	var msg M
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,60 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func FuzzUnmarshalMessage(f *testing.F) {
+	a, b := uuid.New(), uuid.New()
+	for _, msg := range []Message{
+		RequestVote{From: a, To: b, Term: 1},
+		Vote{From: a, To: b, Term: 1, VoteGranted: true},
+		HeartBeat{From: a, To: b, Term: 1},
+		AppendEntries{From: a, To: b, Term: 2, PrevIndex: 1, PrevTerm: 1, CommitIndex: 1,
+			Entries: []Entry[journal.Command]{{Term: 2, Data: journal.Command{ID: "req", Data: []byte(`{}`)}}}},
+		AppendEntriesResponse{From: a, To: b, Term: 2, Success: true, MatchIndex: 1},
+		ClientRequest{From: a, To: b, Term: 2, Command: journal.Command{ID: "req"}},
+	} {
+		data, err := MarshalMessage(msg)
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add([]byte(`{"type":"Vote","data":{"from":"a","to":"b"}}`))
+	f.Add([]byte(`{"type":"Vote","data":{}}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := UnmarshalMessage(data)
+		if err != nil {
+			require.ErrorIs(t, err, ErrInvalidMessage)
+			return
+		}
+		require.NotEqual(t, uuid.Nil, msg.GetFrom())
+		require.NotEqual(t, uuid.Nil, msg.GetTo())
+
+		again, err := MarshalMessage(msg)
+		require.NoError(t, err)
+		decoded, err := UnmarshalMessage(again)
+		require.NoError(t, err)
+		require.Equal(t, msg.String(), decoded.String())
+	})
+}
+
+// TestUnmarshalMessageIDs checks that a peer cannot crash a node with
+// sender or receiver ids that are not UUIDs.
+func TestUnmarshalMessageIDs(t *testing.T) {
+	id := uuid.NewString()
+	for _, typ := range []string{"RequestVote", "Vote", "HeartBeat", "AppendEntries", "AppendEntriesResponse", "ClientRequest"} {
+		for _, ids := range [][2]string{{"nope", id}, {id, "nope"}, {"", id}, {id, ""}} {
+			data := []byte(`{"type":"` + typ + `","data":{"from":"` + ids[0] + `","to":"` + ids[1] + `"}}`)
+			require.NotPanics(t, func() {
+				_, err := UnmarshalMessage(data)
+				require.ErrorIs(t, err, ErrInvalidMessage, string(data))
+			})
+		}
+	}
+}
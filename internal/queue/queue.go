@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrEmpty          = errors.New("queue is empty")
+	ErrNotInFlight    = errors.New("message is not in flight")
+)
+
+type Op string
+
+const (
+	OpEnqueue Op = "enqueue"
+	OpDequeue Op = "dequeue"
+	OpAck     Op = "ack"
+	OpNack    Op = "nack"
+)
+
+// Command is the envelope understood by Queues.Apply. Body is only used by
+// enqueue and Visibility only by dequeue. Ack and nack name the delivery by
+// message ID and the Receipt returned by dequeue.
+type Command struct {
+	Op         Op              `json:"op"`
+	Queue      string          `json:"queue"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Visibility time.Duration   `json:"visibility,omitempty"`
+	ID         int             `json:"id,omitempty"`
+	Receipt    int             `json:"receipt,omitempty"`
+}
+
+// Message is a queued message. ID is the journal index of the enqueue entry
+// and orders the queue. While a message is in flight, Receipt is the index of
+// the dequeue entry that delivered it and Deadline, on the tick-driven clock,
+// is when it becomes visible again.
+type Message struct {
+	ID         int             `json:"id"`
+	Body       json.RawMessage `json:"body"`
+	Deliveries int             `json:"deliveries"`
+	Receipt    int             `json:"receipt,omitempty"`
+	Deadline   time.Duration   `json:"deadline,omitempty"`
+}
+
+type queue struct {
+	// Ready holds visible messages ordered by ID.
+	Ready    []Message       `json:"ready"`
+	InFlight map[int]Message `json:"in_flight"`
+}
+
+// Queues is a set of replicated FIFO queues. A dequeued message stays
+// invisible until it is acked, nacked or its visibility timeout runs out on
+// an applied tick entry, so every replica redelivers it at the same index.
+type Queues struct {
+	mu     sync.RWMutex
+	queues map[string]*queue
+	clock  journal.ElapsedClock
+}
+
+var _ journal.FSM[Command] = (*Queues)(nil)
+
+func New() *Queues {
+	return &Queues{queues: make(map[string]*queue)}
+}
+
+func (q *Queues) Apply(e journal.Entry[Command]) (any, error) {
+	c := e.Command
+	if c.Queue == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch c.Op {
+	case OpEnqueue:
+		qu := q.get(c.Queue)
+		msg := Message{ID: e.Index, Body: c.Body}
+		qu.Ready = append(qu.Ready, msg)
+		return msg, nil
+	case OpDequeue:
+		if c.Visibility <= 0 {
+			return nil, ErrInvalidRequest
+		}
+		qu := q.queues[c.Queue]
+		if qu == nil || len(qu.Ready) == 0 {
+			return nil, ErrEmpty
+		}
+		msg := qu.Ready[0]
+		qu.Ready = qu.Ready[1:]
+		msg.Deliveries++
+		msg.Receipt = e.Index
+		if !q.inFlight() {
+			q.clock.Restart()
+		}
+		msg.Deadline = q.clock.Elapsed + c.Visibility
+		qu.InFlight[msg.ID] = msg
+		return msg, nil
+	case OpAck, OpNack:
+		qu := q.queues[c.Queue]
+		if qu == nil {
+			return nil, ErrNotInFlight
+		}
+		msg, ok := qu.InFlight[c.ID]
+		if !ok || msg.Receipt != c.Receipt {
+			return nil, ErrNotInFlight
+		}
+		delete(qu.InFlight, c.ID)
+		if c.Op == OpNack {
+			qu.push(msg)
+		}
+		return msg, nil
+	}
+	return nil, ErrInvalidRequest
+}
+
+func (q *Queues) get(name string) *queue {
+	qu, ok := q.queues[name]
+	if !ok {
+		qu = &queue{InFlight: make(map[int]Message)}
+		q.queues[name] = qu
+	}
+	return qu
+}
+
+// inFlight reports whether any queue has a message in flight.
+func (q *Queues) inFlight() bool {
+	for _, qu := range q.queues {
+		if len(qu.InFlight) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDeadlines reports whether some delivery waits for its visibility
+// timeout.
+func (q *Queues) HasDeadlines() bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.inFlight()
+}
+
+// push makes an in-flight message visible again at its place in the queue.
+func (qu *queue) push(msg Message) {
+	msg.Receipt, msg.Deadline = 0, 0
+	i, _ := slices.BinarySearchFunc(qu.Ready, msg.ID, func(m Message, id int) int {
+		return m.ID - id
+	})
+	qu.Ready = slices.Insert(qu.Ready, i, msg)
+}
+
+// Tick advances the queue clock and returns timed out deliveries to their
+// queues.
+func (q *Queues) Tick(_ int, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.clock.Advance(now)
+	for _, qu := range q.queues {
+		for id, msg := range qu.InFlight {
+			if msg.Deadline <= q.clock.Elapsed {
+				delete(qu.InFlight, id)
+				qu.push(msg)
+			}
+		}
+	}
+}
+
+// Len returns the number of visible and in-flight messages in a queue.
+func (q *Queues) Len(name string) (ready, inFlight int) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	qu, ok := q.queues[name]
+	if !ok {
+		return 0, 0
+	}
+	return len(qu.Ready), len(qu.InFlight)
+}
+
+type snapshot struct {
+	Queues map[string]*queue    `json:"queues"`
+	Clock  journal.ElapsedClock `json:"clock"`
+}
+
+func (q *Queues) Snapshot() ([]byte, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return json.Marshal(snapshot{Queues: q.queues, Clock: q.clock})
+}
+
+func (q *Queues) Restore(data []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queues = s.Queues
+	if q.queues == nil {
+		q.queues = make(map[string]*queue)
+	}
+	for _, qu := range q.queues {
+		if qu.InFlight == nil {
+			qu.InFlight = make(map[int]Message)
+		}
+	}
+	q.clock = s.Clock
+	return nil
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+)
+
+func TestQueues(t *testing.T) {
+	q := New()
+	start := time.Unix(100, 0)
+	q.Tick(0, start)
+
+	index := 0
+	apply := func(c Command) (Message, error) {
+		index++
+		c.Queue = "jobs"
+		res, err := q.Apply(journal.Entry[Command]{Index: index, Command: c})
+		msg, _ := res.(Message)
+		return msg, err
+	}
+
+	for _, body := range []string{`"a"`, `"b"`, `"c"`} {
+		_, err := apply(Command{Op: OpEnqueue, Body: json.RawMessage(body)})
+		require.NoError(t, err)
+	}
+
+	a, err := apply(Command{Op: OpDequeue, Visibility: 10 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, Message{ID: 1, Body: json.RawMessage(`"a"`), Deliveries: 1, Receipt: 4, Deadline: 10 * time.Second}, a)
+
+	b, err := apply(Command{Op: OpDequeue, Visibility: 2 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, 2, b.ID)
+
+	// nothing was in flight before a, so the clock restarts at the next tick
+	q.Tick(index, start.Add(time.Hour))
+	start = start.Add(time.Hour)
+
+	// acking with a stale receipt or twice fails
+	_, err = apply(Command{Op: OpAck, ID: a.ID, Receipt: b.Receipt})
+	require.ErrorIs(t, err, ErrNotInFlight)
+	_, err = apply(Command{Op: OpAck, ID: a.ID, Receipt: a.Receipt})
+	require.NoError(t, err)
+	_, err = apply(Command{Op: OpAck, ID: a.ID, Receipt: a.Receipt})
+	require.ErrorIs(t, err, ErrNotInFlight)
+
+	// b times out and goes back in front of c
+	q.Tick(index, start.Add(3*time.Second))
+	ready, inFlight := q.Len("jobs")
+	require.Equal(t, 2, ready)
+	require.Zero(t, inFlight)
+
+	again, err := apply(Command{Op: OpDequeue, Visibility: time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, b.ID, again.ID)
+	require.Equal(t, 2, again.Deliveries)
+
+	// the consumer that lost b cannot ack the new delivery
+	_, err = apply(Command{Op: OpAck, ID: b.ID, Receipt: b.Receipt})
+	require.ErrorIs(t, err, ErrNotInFlight)
+
+	_, err = apply(Command{Op: OpNack, ID: again.ID, Receipt: again.Receipt})
+	require.NoError(t, err)
+
+	data, err := q.Snapshot()
+	require.NoError(t, err)
+	restored := New()
+	require.NoError(t, restored.Restore(data))
+
+	for _, want := range []int{2, 3} {
+		res, err := restored.Apply(journal.Entry[Command]{Index: 20 + want, Command: Command{Op: OpDequeue, Queue: "jobs", Visibility: time.Minute}})
+		require.NoError(t, err)
+		require.Equal(t, want, res.(Message).ID)
+	}
+	_, err = restored.Apply(journal.Entry[Command]{Index: 30, Command: Command{Op: OpDequeue, Queue: "jobs", Visibility: time.Minute}})
+	require.ErrorIs(t, err, ErrEmpty)
+
+	_, err = apply(Command{Op: OpDequeue})
+	require.ErrorIs(t, err, ErrInvalidRequest)
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encoder appends proto3 fields to buf. Fields holding their zero value are
+// omitted, as proto3 requires.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int64(num protowire.Number, v int64) {
+	if v == 0 {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.VarintType)
+	e.buf = protowire.AppendVarint(e.buf, uint64(v))
+}
+
+func (e *encoder) bool(num protowire.Number, v bool) {
+	if !v {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.VarintType)
+	e.buf = protowire.AppendVarint(e.buf, protowire.EncodeBool(v))
+}
+
+func (e *encoder) bytes(num protowire.Number, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, v)
+}
+
+func (e *encoder) string(num protowire.Number, v string) {
+	if v == "" {
+		return
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendString(e.buf, v)
+}
+
+// message encodes a nested message. Unlike scalars it is written even when
+// empty, so a set oneof or repeated element is never lost.
+func (e *encoder) message(num protowire.Number, fn func(*encoder)) {
+	var inner encoder
+	fn(&inner)
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, inner.buf)
+}
+
+// field is one decoded field. value holds varint and fixed-size values,
+// bytes holds length-delimited ones.
+type field struct {
+	num   protowire.Number
+	typ   protowire.Type
+	value uint64
+	bytes []byte
+}
+
+func (f field) int64() int64 {
+	return int64(f.value)
+}
+
+func (f field) bool() bool {
+	return protowire.DecodeBool(f.value)
+}
+
+func (f field) string() string {
+	return string(f.bytes)
+}
+
+// decode calls fn for every field of a message in wire order. Unknown fields
+// are passed to fn too, which is expected to ignore them; groups are skipped.
+func decode(data []byte, fn func(field) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			f.value, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			f.value = uint64(v)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expect checks that a known field arrived with the wire type the schema
+// gives it.
+func (f field) expect(typ protowire.Type) error {
+	if f.typ != typ {
+		return fmt.Errorf("field %d: wire type %d, want %d", f.num, f.typ, typ)
+	}
+	return nil
+}
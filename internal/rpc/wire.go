@@ -0,0 +1,319 @@
+// Package rpc encodes node messages as protobuf, following raft.proto, so
+// peers written in other languages can talk to a node.
+package rpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+)
+
+// Envelope field numbers, one per message type.
+const (
+	fieldRequestVote protowire.Number = iota + 1
+	fieldVote
+	fieldHeartBeat
+	fieldAppendEntries
+	fieldAppendEntriesResponse
+	fieldClientRequest
+	fieldInstallSnapshot
+)
+
+var errEmptyEnvelope = errors.New("envelope carries no message")
+
+// Wire is the protobuf wire encoding of node messages. It can be passed to
+// transport.Listen.
+type Wire struct{}
+
+func (Wire) Marshal(msg node.Message) ([]byte, error) {
+	return Marshal(msg)
+}
+
+func (Wire) Unmarshal(data []byte) (node.Message, error) {
+	return Unmarshal(data)
+}
+
+// Marshal encodes msg as a raft.Envelope.
+func Marshal(msg node.Message) ([]byte, error) {
+	var e encoder
+	switch m := msg.(type) {
+	case node.RequestVote:
+		e.message(fieldRequestVote, func(e *encoder) {
+			header(e, m.From, m.To, m.Term)
+		})
+	case node.Vote:
+		e.message(fieldVote, func(e *encoder) {
+			header(e, m.From, m.To, m.Term)
+			e.bool(4, m.VoteGranted)
+		})
+	case node.HeartBeat:
+		e.message(fieldHeartBeat, func(e *encoder) {
+			header(e, m.From, m.To, m.Term)
+		})
+	case node.AppendEntries:
+		e.message(fieldAppendEntries, func(e *encoder) {
+			header(e, m.From, m.To, m.Term)
+			e.int64(4, int64(m.PrevIndex))
+			e.int64(5, int64(m.PrevTerm))
+			e.int64(6, int64(m.CommitIndex))
+			for _, entry := range m.Entries {
+				e.message(7, func(e *encoder) {
+					e.int64(1, int64(entry.Term))
+					e.message(2, func(e *encoder) { command(e, entry.Data) })
+				})
+			}
+		})
+	case node.AppendEntriesResponse:
+		e.message(fieldAppendEntriesResponse, func(e *encoder) {
+			header(e, m.From, m.To, m.Term)
+			e.bool(4, m.Success)
+			e.int64(5, int64(m.MatchIndex))
+		})
+	case node.ClientRequest:
+		e.message(fieldClientRequest, func(e *encoder) {
+			header(e, m.From, m.To, m.Term)
+			e.message(4, func(e *encoder) { command(e, m.Command) })
+		})
+	default:
+		return nil, fmt.Errorf("unsupported message type `%s`", msg.Type())
+	}
+	return e.buf, nil
+}
+
+func header(e *encoder, from, to node.ID, term int) {
+	e.string(1, from.String())
+	e.string(2, to.String())
+	e.int64(3, int64(term))
+}
+
+func command(e *encoder, c journal.Command) {
+	e.string(1, c.ID)
+	e.string(2, c.Machine)
+	e.string(3, c.Type)
+	e.bytes(4, c.Data)
+}
+
+// Unmarshal decodes a raft.Envelope encoded by Marshal or by any other
+// protobuf implementation of raft.proto. Unknown fields are skipped.
+func Unmarshal(data []byte) (node.Message, error) {
+	var msg node.Message
+	err := decode(data, func(f field) error {
+		if f.num < fieldRequestVote || f.num > fieldInstallSnapshot {
+			return nil
+		}
+		if err := f.expect(protowire.BytesType); err != nil {
+			return err
+		}
+
+		var err error
+		switch f.num {
+		case fieldRequestVote:
+			msg, err = unmarshalRequestVote(f.bytes)
+		case fieldVote:
+			msg, err = unmarshalVote(f.bytes)
+		case fieldHeartBeat:
+			msg, err = unmarshalHeartBeat(f.bytes)
+		case fieldAppendEntries:
+			msg, err = unmarshalAppendEntries(f.bytes)
+		case fieldAppendEntriesResponse:
+			msg, err = unmarshalAppendEntriesResponse(f.bytes)
+		case fieldClientRequest:
+			msg, err = unmarshalClientRequest(f.bytes)
+		case fieldInstallSnapshot:
+			err = errors.New("snapshot transfer is not supported")
+		}
+		return err
+	})
+	if err == nil && msg == nil {
+		err = errEmptyEnvelope
+	}
+	if err != nil && !errors.Is(err, node.ErrInvalidMessage) {
+		err = fmt.Errorf("%w: %w", node.ErrInvalidMessage, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := node.Validate(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// headerField decodes the from, to and term fields every message starts
+// with. It reports whether f was one of them.
+func headerField(f field, from, to *node.ID, term *int) (bool, error) {
+	switch f.num {
+	case 1, 2:
+		if err := f.expect(protowire.BytesType); err != nil {
+			return true, err
+		}
+		id, err := uuid.Parse(f.string())
+		if err != nil {
+			return true, fmt.Errorf("%w: field %d: %v", node.ErrInvalidMessage, f.num, err)
+		}
+		if f.num == 1 {
+			*from = id
+		} else {
+			*to = id
+		}
+	case 3:
+		if err := f.expect(protowire.VarintType); err != nil {
+			return true, err
+		}
+		*term = int(f.int64())
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func unmarshalRequestVote(data []byte) (node.Message, error) {
+	var m node.RequestVote
+	err := decode(data, func(f field) error {
+		_, err := headerField(f, &m.From, &m.To, &m.Term)
+		return err
+	})
+	return m, err
+}
+
+func unmarshalVote(data []byte) (node.Message, error) {
+	var m node.Vote
+	err := decode(data, func(f field) error {
+		if ok, err := headerField(f, &m.From, &m.To, &m.Term); ok {
+			return err
+		}
+		if f.num == 4 {
+			m.VoteGranted = f.bool()
+			return f.expect(protowire.VarintType)
+		}
+		return nil
+	})
+	return m, err
+}
+
+func unmarshalHeartBeat(data []byte) (node.Message, error) {
+	var m node.HeartBeat
+	err := decode(data, func(f field) error {
+		_, err := headerField(f, &m.From, &m.To, &m.Term)
+		return err
+	})
+	return m, err
+}
+
+func unmarshalAppendEntries(data []byte) (node.Message, error) {
+	var m node.AppendEntries
+	err := decode(data, func(f field) error {
+		if ok, err := headerField(f, &m.From, &m.To, &m.Term); ok {
+			return err
+		}
+		switch f.num {
+		case 4:
+			m.PrevIndex = int(f.int64())
+			return f.expect(protowire.VarintType)
+		case 5:
+			m.PrevTerm = int(f.int64())
+			return f.expect(protowire.VarintType)
+		case 6:
+			m.CommitIndex = int(f.int64())
+			return f.expect(protowire.VarintType)
+		case 7:
+			if err := f.expect(protowire.BytesType); err != nil {
+				return err
+			}
+			entry, err := unmarshalEntry(f.bytes)
+			if err != nil {
+				return err
+			}
+			m.Entries = append(m.Entries, entry)
+		}
+		return nil
+	})
+	return m, err
+}
+
+func unmarshalEntry(data []byte) (node.Entry[journal.Command], error) {
+	var entry node.Entry[journal.Command]
+	err := decode(data, func(f field) error {
+		switch f.num {
+		case 1:
+			entry.Term = int(f.int64())
+			return f.expect(protowire.VarintType)
+		case 2:
+			if err := f.expect(protowire.BytesType); err != nil {
+				return err
+			}
+			var err error
+			entry.Data, err = unmarshalCommand(f.bytes)
+			return err
+		}
+		return nil
+	})
+	return entry, err
+}
+
+func unmarshalAppendEntriesResponse(data []byte) (node.Message, error) {
+	var m node.AppendEntriesResponse
+	err := decode(data, func(f field) error {
+		if ok, err := headerField(f, &m.From, &m.To, &m.Term); ok {
+			return err
+		}
+		switch f.num {
+		case 4:
+			m.Success = f.bool()
+			return f.expect(protowire.VarintType)
+		case 5:
+			m.MatchIndex = int(f.int64())
+			return f.expect(protowire.VarintType)
+		}
+		return nil
+	})
+	return m, err
+}
+
+func unmarshalClientRequest(data []byte) (node.Message, error) {
+	var m node.ClientRequest
+	err := decode(data, func(f field) error {
+		if ok, err := headerField(f, &m.From, &m.To, &m.Term); ok {
+			return err
+		}
+		if f.num == 4 {
+			if err := f.expect(protowire.BytesType); err != nil {
+				return err
+			}
+			var err error
+			m.Command, err = unmarshalCommand(f.bytes)
+			return err
+		}
+		return nil
+	})
+	return m, err
+}
+
+func unmarshalCommand(data []byte) (journal.Command, error) {
+	var c journal.Command
+	err := decode(data, func(f field) error {
+		if f.num < 1 || f.num > 4 {
+			return nil
+		}
+		if err := f.expect(protowire.BytesType); err != nil {
+			return err
+		}
+		switch f.num {
+		case 1:
+			c.ID = f.string()
+		case 2:
+			c.Machine = f.string()
+		case 3:
+			c.Type = f.string()
+		case 4:
+			c.Data = append([]byte(nil), f.bytes...)
+		}
+		return nil
+	})
+	return c, err
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/transport"
+)
+
+func messages(from, to node.ID) []node.Message {
+	cmd := journal.Command{ID: "req", Machine: "locks", Type: "json", Data: []byte(`{"key":"value"}`)}
+	return []node.Message{
+		node.RequestVote{From: from, To: to, Term: 1},
+		node.Vote{From: from, To: to, Term: 1, VoteGranted: true},
+		node.HeartBeat{From: from, To: to, Term: 2},
+		node.AppendEntries{
+			From:        from,
+			To:          to,
+			Term:        3,
+			PrevIndex:   -1,
+			PrevTerm:    -1,
+			CommitIndex: 4,
+			Entries: []node.Entry[journal.Command]{
+				{Term: 3, Data: cmd},
+				{Term: 3, Data: journal.NewTick(time.Unix(10, 0))},
+			},
+		},
+		node.AppendEntriesResponse{From: from, To: to, Term: 3, Success: true, MatchIndex: 5},
+		node.ClientRequest{From: from, To: to, Term: 3, Command: cmd},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, msg := range messages(uuid.New(), uuid.New()) {
+		t.Run(msg.Type(), func(t *testing.T) {
+			data, err := Marshal(msg)
+			require.NoError(t, err)
+
+			got, err := Unmarshal(data)
+			require.NoError(t, err)
+			require.Equal(t, msg, got)
+		})
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	from := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	to := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	vote := node.Vote{From: from, To: to, Term: -1, VoteGranted: true}
+
+	// bytes as produced by protoc-generated code for
+	// Envelope{vote: {from, to, term: -1, vote_granted: true}}
+	want := slices.Concat(
+		[]byte{0x12, 0x59},
+		[]byte{0x0a, 0x24}, []byte(from.String()),
+		[]byte{0x12, 0x24}, []byte(to.String()),
+		[]byte{0x18, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		[]byte{0x20, 0x01},
+	)
+	data, err := Marshal(vote)
+	require.NoError(t, err)
+	require.Equal(t, want, data)
+
+	// unknown fields are skipped
+	withUnknown := append([]byte{0x40, 0x07}, want...)
+	msg, err := Unmarshal(withUnknown)
+	require.NoError(t, err)
+	require.Equal(t, vote, msg)
+
+	_, err = Unmarshal(nil)
+	require.ErrorIs(t, err, errEmptyEnvelope)
+
+	_, err = Unmarshal(want[:len(want)-3])
+	require.Error(t, err)
+
+	// term sent as a string
+	_, err = Unmarshal([]byte{0x0a, 0x03, 0x1a, 0x01, 'x'})
+	require.ErrorIs(t, err, node.ErrInvalidMessage)
+
+	// sender is not an id
+	_, err = Unmarshal([]byte{0x12, 0x03, 0x0a, 0x01, 'a'})
+	require.ErrorIs(t, err, node.ErrInvalidMessage)
+
+	// snapshot chunks are only reserved in the schema
+	_, err = Unmarshal([]byte{0x3a, 0x00})
+	require.ErrorIs(t, err, node.ErrInvalidMessage)
+
+	// receiver is missing
+	_, err = Unmarshal(slices.Concat([]byte{0x12, 0x26, 0x0a, 0x24}, []byte(from.String())))
+	require.ErrorIs(t, err, node.ErrInvalidMessage)
+}
+
+func TestTransport(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	ta, err := transport.Listen(a, "127.0.0.1:0", Wire{})
+	require.NoError(t, err)
+	defer ta.Close()
+
+	tb, err := transport.Listen(b, "127.0.0.1:0", Wire{})
+	require.NoError(t, err)
+	defer tb.Close()
+
+	require.NoError(t, ta.AddPeer(b, tb.Addr().String()))
+
+	for _, msg := range messages(a, b) {
+		ta.Send(b, msg)
+		select {
+		case got := <-tb.Receive():
+			require.Equal(t, msg, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not delivered", msg.Type())
+		}
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, msg := range messages(uuid.New(), uuid.New()) {
+		data, err := Marshal(msg)
+		require.NoError(f, err)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := Unmarshal(data)
+		if err != nil {
+			require.ErrorIs(t, err, node.ErrInvalidMessage)
+			return
+		}
+		require.NotEqual(t, uuid.Nil, msg.GetFrom())
+		require.NotEqual(t, uuid.Nil, msg.GetTo())
+
+		again, err := Marshal(msg)
+		require.NoError(t, err)
+		decoded, err := Unmarshal(again)
+		require.NoError(t, err)
+		require.Equal(t, msg.String(), decoded.String())
+	})
+}
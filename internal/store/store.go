@@ -0,0 +1,91 @@
+package store
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/lock"
+	raftmap "github.com/peyuaa/raft/internal/map"
+	"github.com/peyuaa/raft/internal/queue"
+)
+
+const (
+	// Default is the map used by requests that do not name a store.
+	Default = "default"
+	// Locks is the machine name of the lock table.
+	Locks journal.Name[lock.Command] = "locks"
+	// Queues is the machine name of the work queues.
+	Queues journal.Name[queue.Command] = "queues"
+)
+
+// MapCommand is the command applied by the store's maps.
+type MapCommand = raftmap.Command[string, any]
+
+// MapName returns the machine name of the map registered under name.
+func MapName(name string) journal.Name[MapCommand] {
+	return journal.Name[MapCommand](name)
+}
+
+// Store is the state served by cmd/raft: named key-value maps, the lock table
+// and the work queues, each registered as its own machine in a
+// journal.Registry.
+type Store struct {
+	maps     map[string]*raftmap.Map[string, any]
+	locks    *lock.Table
+	queues   *queue.Queues
+	registry *journal.Registry
+}
+
+// New creates a store with a map for every name, or only the default map if
+// no names are given.
+func New(names ...string) (*Store, error) {
+	if len(names) == 0 {
+		names = []string{Default}
+	}
+
+	s := &Store{
+		maps:     make(map[string]*raftmap.Map[string, any], len(names)),
+		locks:    lock.New(),
+		queues:   queue.New(),
+		registry: journal.NewRegistry(),
+	}
+	if err := journal.RegisterFSM(s.registry, Locks, s.locks); err != nil {
+		return nil, err
+	}
+	if err := journal.RegisterFSM(s.registry, Queues, s.queues); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		m := raftmap.New[string, any]()
+		if err := journal.RegisterFSM(s.registry, MapName(name), m); err != nil {
+			return nil, err
+		}
+		s.maps[name] = m
+	}
+	return s, nil
+}
+
+// Map returns the map registered under name.
+func (s *Store) Map(name string) (*raftmap.Map[string, any], bool) {
+	m, ok := s.maps[name]
+	return m, ok
+}
+
+// Maps returns the map names in order.
+func (s *Store) Maps() []string {
+	return slices.Sorted(maps.Keys(s.maps))
+}
+
+func (s *Store) Locks() *lock.Table {
+	return s.locks
+}
+
+func (s *Store) Queues() *queue.Queues {
+	return s.queues
+}
+
+// Registry is the processor the node applies entries to.
+func (s *Store) Registry() *journal.Registry {
+	return s.registry
+}
@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+func TestSession(t *testing.T) {
+	key := frameKey([]byte("secret"), []byte("offer"), []byte("reply"))
+	sender := &session{enc: newCompressor(0, Compression{}), key: key}
+	receiver := &session{key: key}
+
+	first, second := sender.seal([]byte("first")), sender.seal([]byte("second"))
+
+	// any flipped bit fails the check
+	for i := range first {
+		forged := append([]byte(nil), first...)
+		forged[i] ^= 1
+		_, err := (&session{key: key}).open(forged)
+		require.ErrorIs(t, err, ErrUnauthenticated)
+	}
+
+	// frames are accepted once, in order
+	_, err := receiver.open(second)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+	got, err := receiver.open(first)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), got)
+	_, err = receiver.open(first)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+	got, err = receiver.open(second)
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), got)
+
+	other := &session{key: frameKey([]byte("secret"), []byte("offer"), []byte("another reply"))}
+	_, err = other.open(first)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	_, err = receiver.open(nil)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+}
+
+func TestTCPAuthenticated(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	secret := []byte("cluster secret")
+
+	tb, err := ListenTCP(b, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tb.Close()
+	tb.SetSecret(secret)
+
+	ta, err := ListenTCP(a, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ta.Close()
+	ta.SetSecret(secret)
+	require.NoError(t, ta.AddPeer(b, tb.Addr().String()))
+
+	// c does not know the secret; it cannot verify b's hello and never sends
+	// anything
+	tc, err := ListenTCP(c, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tc.Close()
+	tc.SetSecret([]byte("guess"))
+	require.NoError(t, tc.AddPeer(b, tb.Addr().String()))
+	tc.Send(b, node.AppendEntries{From: a, To: b, Term: 100})
+
+	// a peer that does not authenticate at all is refused
+	conn, err := net.Dial("tcp", tb.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	frame, err := JSON{}.Marshal(node.AppendEntries{From: a, To: b, Term: 100})
+	require.NoError(t, err)
+	require.NoError(t, writeFrame(conn, frame))
+
+	require.Eventually(t, func() bool {
+		return tb.Rejected() >= 1 && tc.Rejected() >= 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sent := node.HeartBeat{From: a, To: b, Term: 1}
+	ta.Send(b, sent)
+	require.Equal(t, node.Message(sent), receive(t, tb))
+
+	select {
+	case msg := <-tb.Receive():
+		t.Fatalf("unexpected message %v", msg)
+	default:
+	}
+}
+
+// TestTCPReplay replays authenticated frames on the connection they were
+// sent on and on a new one.
+func TestTCPReplay(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	secret := []byte("cluster secret")
+
+	tb, err := ListenTCP(b, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tb.Close()
+	tb.SetSecret(secret)
+
+	ta, err := ListenTCP(a, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ta.Close()
+	ta.SetSecret(secret)
+
+	dial := func() (net.Conn, *session) {
+		conn, err := net.Dial("tcp", tb.Addr().String())
+		require.NoError(t, err)
+		sess, err := ta.handshake(conn)
+		require.NoError(t, err)
+		return conn, sess
+	}
+
+	msg, err := JSON{}.Marshal(node.HeartBeat{From: a, To: b, Term: 1})
+	require.NoError(t, err)
+
+	conn, sess := dial()
+	defer conn.Close()
+	sealed := sess.seal(msg)
+	require.NoError(t, writeFrame(conn, sealed))
+	require.Equal(t, node.Message(node.HeartBeat{From: a, To: b, Term: 1}), receive(t, tb))
+
+	require.NoError(t, writeFrame(conn, sealed))
+	require.Eventually(t, func() bool { return tb.Rejected() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	other, _ := dial()
+	defer other.Close()
+	require.NoError(t, writeFrame(other, sealed))
+	require.Eventually(t, func() bool { return tb.Rejected() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	select {
+	case msg := <-tb.Receive():
+		t.Fatalf("replayed message %v", msg)
+	default:
+	}
+}
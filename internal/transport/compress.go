@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Compression configures flate compression of large frames on TCP links.
+// A link compresses only if both of its ends enabled compression; they agree
+// on it when the connection is dialled. Frames smaller than Threshold, which
+// in practice is everything but AppendEntries carrying large entries, are
+// sent as they are. The zero value disables compression.
+type Compression struct {
+	Threshold int
+}
+
+// Frame encodings of a connection that completed the handshake.
+const (
+	encodingRaw   byte = 0
+	encodingFlate byte = 1
+)
+
+func (c Compression) features() byte {
+	if c.Threshold > 0 {
+		return featureFlate
+	}
+	return 0
+}
+
+// compressor encodes the frames of one link. A zero threshold sends every
+// frame raw.
+type compressor struct {
+	threshold int
+	buf       bytes.Buffer
+	w         *flate.Writer
+}
+
+func newCompressor(features byte, cfg Compression) *compressor {
+	c := &compressor{}
+	if features&featureFlate != 0 {
+		c.threshold = cfg.Threshold
+	}
+	return c
+}
+
+// encode prefixes frame with its encoding, compressing it if it is large
+// enough and compression pays off.
+func (c *compressor) encode(frame []byte) []byte {
+	if c.threshold > 0 && len(frame) >= c.threshold {
+		if out, ok := c.deflate(frame); ok {
+			return out
+		}
+	}
+	return append([]byte{encodingRaw}, frame...)
+}
+
+func (c *compressor) deflate(frame []byte) ([]byte, bool) {
+	c.buf.Reset()
+	c.buf.WriteByte(encodingFlate)
+	if c.w == nil {
+		// BestSpeed keeps replication latency low; entries are usually
+		// repetitive enough to shrink well anyway
+		c.w, _ = flate.NewWriter(&c.buf, flate.BestSpeed)
+	} else {
+		c.w.Reset(&c.buf)
+	}
+	if _, err := c.w.Write(frame); err != nil {
+		return nil, false
+	}
+	if err := c.w.Close(); err != nil {
+		return nil, false
+	}
+	if c.buf.Len() >= len(frame)+1 {
+		return nil, false
+	}
+	return bytes.Clone(c.buf.Bytes()), true
+}
+
+// decodeFrame undoes compressor.encode. A compressed frame may not inflate
+// beyond maxFrameSize.
+func decodeFrame(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, errors.New("frame without encoding")
+	}
+	switch frame[0] {
+	case encodingRaw:
+		return frame[1:], nil
+	case encodingFlate:
+		r := flate.NewReader(bytes.NewReader(frame[1:]))
+		defer r.Close()
+		data, err := io.ReadAll(io.LimitReader(r, maxFrameSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxFrameSize {
+			return nil, errFrameTooLarge
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown frame encoding %d", frame[0])
+}
@@ -0,0 +1,212 @@
+package transport
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+	"github.com/peyuaa/raft/internal/rpc"
+)
+
+// largeEntries returns an AppendEntries whose entry holds a value of about
+// size bytes, shaped like the JSON documents clients usually store.
+func largeEntries(t testing.TB, size int) node.AppendEntries {
+	t.Helper()
+	var value strings.Builder
+	for i := 0; value.Len() < size; i++ {
+		fmt.Fprintf(&value, `{"user":%d,"name":"user-%d","email":"user-%d@example.com","active":%t},`, i, i, i, i%3 == 0)
+	}
+	cmd, err := journal.Encode(journal.JSONCodec{}, map[string]string{"key": "users", "value": value.String()})
+	require.NoError(t, err)
+	cmd.ID = "req"
+
+	return node.AppendEntries{
+		From:        uuid.New(),
+		To:          uuid.New(),
+		Term:        3,
+		PrevIndex:   10,
+		PrevTerm:    3,
+		CommitIndex: 10,
+		Entries:     []node.Entry[journal.Command]{{Term: 3, Data: cmd}},
+	}
+}
+
+func TestCompressor(t *testing.T) {
+	frame, err := JSON{}.Marshal(largeEntries(t, 16<<10))
+	require.NoError(t, err)
+
+	enc := newCompressor(featureFlate, Compression{Threshold: 1024})
+	out := enc.encode(frame)
+	require.Equal(t, encodingFlate, out[0])
+	require.Less(t, len(out), len(frame)/4)
+	got, err := decodeFrame(out)
+	require.NoError(t, err)
+	require.Equal(t, frame, got)
+
+	// the writer is reused between frames
+	got, err = decodeFrame(enc.encode(frame))
+	require.NoError(t, err)
+	require.Equal(t, frame, got)
+
+	small := []byte(`{"type":"HeartBeat"}`)
+	out = enc.encode(small)
+	require.Equal(t, encodingRaw, out[0])
+	got, err = decodeFrame(out)
+	require.NoError(t, err)
+	require.Equal(t, small, got)
+
+	// random bytes do not shrink and are sent raw
+	random := make([]byte, 4096)
+	_, _ = rand.Read(random)
+	require.Equal(t, encodingRaw, enc.encode(random)[0])
+
+	// the peer did not agree to compression
+	require.Equal(t, encodingRaw, newCompressor(0, Compression{Threshold: 1024}).encode(frame)[0])
+
+	_, err = decodeFrame([]byte{7, 'x'})
+	require.Error(t, err)
+	_, err = decodeFrame(nil)
+	require.Error(t, err)
+}
+
+func TestDecodeFrameLimit(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteByte(encodingFlate)
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	require.NoError(t, err)
+	zeros := make([]byte, 1<<20)
+	for range maxFrameSize/len(zeros) + 1 {
+		_, err = w.Write(zeros)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	_, err = decodeFrame(buf.Bytes())
+	require.ErrorIs(t, err, errFrameTooLarge)
+}
+
+func TestTCPCompression(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sender   Compression
+		receiver Compression
+	}{
+		{"both", Compression{Threshold: 1024}, Compression{Threshold: 1024}},
+		{"sender only", Compression{Threshold: 1024}, Compression{}},
+		{"receiver only", Compression{}, Compression{Threshold: 1024}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := largeEntries(t, 64<<10)
+
+			tb, err := ListenTCP(msg.To, "127.0.0.1:0")
+			require.NoError(t, err)
+			defer tb.Close()
+			tb.SetCompression(tc.receiver)
+
+			ta, err := ListenTCP(msg.From, "127.0.0.1:0")
+			require.NoError(t, err)
+			defer ta.Close()
+			ta.SetCompression(tc.sender)
+			require.NoError(t, ta.AddPeer(msg.To, tb.Addr().String()))
+
+			ta.Send(msg.To, msg)
+			require.Equal(t, node.Message(msg), receive(t, tb))
+
+			heartBeat := node.HeartBeat{From: msg.From, To: msg.To, Term: 3}
+			ta.Send(msg.To, heartBeat)
+			require.Equal(t, node.Message(heartBeat), receive(t, tb))
+			require.Zero(t, tb.Rejected())
+		})
+	}
+}
+
+// BenchmarkCompression reports the bytes one AppendEntries takes on the wire,
+// length prefix included, with and without compression.
+func BenchmarkCompression(b *testing.B) {
+	for _, wire := range []struct {
+		name string
+		wire Wire
+	}{
+		{"json", JSON{}},
+		{"proto", rpc.Wire{}},
+	} {
+		for _, size := range []int{1 << 10, 16 << 10, 256 << 10} {
+			frame, err := wire.wire.Marshal(largeEntries(b, size))
+			require.NoError(b, err)
+
+			for _, cfg := range []struct {
+				name     string
+				features byte
+			}{
+				{"raw", 0},
+				{"flate", featureFlate},
+			} {
+				b.Run(fmt.Sprintf("%s/%dKiB/%s", wire.name, size>>10, cfg.name), func(b *testing.B) {
+					enc := newCompressor(cfg.features, Compression{Threshold: 512})
+					var out []byte
+					b.SetBytes(int64(len(frame)))
+					for range b.N {
+						out = enc.encode(frame)
+					}
+					b.ReportMetric(float64(4+len(out)), "wire-B/op")
+				})
+			}
+		}
+	}
+}
+
+// TestTCPCompressionUnauthenticated sends a compression bomb on a connection
+// whose dialler does not hold the secret. It is rejected by its MAC before
+// it is inflated.
+func TestTCPCompressionUnauthenticated(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	tb, err := ListenTCP(b, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tb.Close()
+	tb.SetSecret([]byte("cluster secret"))
+	tb.SetCompression(Compression{Threshold: 512})
+
+	// an attacker can complete the hello exchange, it only cannot verify
+	// the answer
+	ta, err := ListenTCP(a, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ta.Close()
+	ta.SetSecret([]byte("guess"))
+	ta.SetCompression(Compression{Threshold: 512})
+
+	conn, err := net.Dial("tcp", tb.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = ta.handshake(conn)
+	require.ErrorIs(t, err, ErrUnauthenticated)
+
+	var bomb bytes.Buffer
+	bomb.WriteByte(encodingFlate)
+	w, err := flate.NewWriter(&bomb, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 32<<20))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	guessed := make([]byte, macSize)
+	require.NoError(t, writeFrame(conn, append(bomb.Bytes(), frameMAC(guessed, 0, bomb.Bytes())...)))
+
+	// a frame that fails to decode leaves the connection open, one that
+	// fails its MAC closes it
+	require.Eventually(t, func() bool { return tb.Rejected() == 1 }, 5*time.Second, 10*time.Millisecond)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	require.Empty(t, tb.Receive())
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+)
+
+// A dialled connection starts with a hello frame, unless the dialler enabled
+// neither compression nor a secret: helloMagic, the features the dialler
+// offers and a random nonce. The acceptor answers with
+// a hello holding the features both ends support and a nonce of its own;
+// with a cluster secret the answer ends with a MAC binding it to the offer.
+// From then on every frame starts with its encoding and, with a secret, ends
+// with a MAC keyed by both nonces, see session. A connection that does not
+// start with a hello carries plain frames, which a node with a secret
+// refuses.
+const (
+	helloMagic = "\x00raft-hello"
+	helloSize  = len(helloMagic) + 1 + nonceSize
+
+	featureFlate byte = 1 << 0
+	featureAuth  byte = 1 << 1
+)
+
+var errBadHello = errors.New("malformed hello")
+
+type hello struct {
+	features byte
+	nonce    [nonceSize]byte
+}
+
+func newHello(features byte) hello {
+	h := hello{features: features}
+	_, _ = rand.Read(h.nonce[:])
+	return h
+}
+
+func (h hello) frame() []byte {
+	frame := make([]byte, 0, helloSize+macSize)
+	frame = append(frame, helloMagic...)
+	frame = append(frame, h.features)
+	return append(frame, h.nonce[:]...)
+}
+
+// parseHello parses a hello frame and the MAC that may follow it; ok is false
+// if frame is not a hello.
+func parseHello(frame []byte) (h hello, mac []byte, ok bool, err error) {
+	if !bytes.HasPrefix(frame, []byte(helloMagic)) {
+		return hello{}, nil, false, nil
+	}
+	switch len(frame) {
+	case helloSize:
+	case helloSize + macSize:
+		mac = frame[helloSize:]
+	default:
+		return hello{}, nil, true, errBadHello
+	}
+	h.features = frame[len(helloMagic)]
+	copy(h.nonce[:], frame[len(helloMagic)+1:helloSize])
+	return h, mac, true, nil
+}
+
+// session is one end of a connection that completed the hello exchange.
+// Frames are compressed before they are authenticated, so the receiver
+// checks a frame's MAC before it inflates anything. The MAC covers the
+// frame's sequence number on the connection, so a frame cannot be replayed,
+// dropped or reordered unnoticed, and its key is derived from both hellos,
+// so frames recorded on one connection are rejected on any other.
+type session struct {
+	enc *compressor
+	// key is nil on connections without a cluster secret.
+	key []byte
+	seq uint64
+}
+
+// seal encodes a frame for sending.
+func (s *session) seal(frame []byte) []byte {
+	out := s.enc.encode(frame)
+	if s.key != nil {
+		out = append(out, frameMAC(s.key, s.seq, out)...)
+		s.seq++
+	}
+	return out
+}
+
+// open checks and decodes a received frame. The connection must be closed
+// after ErrUnauthenticated, as the ends no longer agree on the sequence.
+func (s *session) open(frame []byte) ([]byte, error) {
+	if s.key != nil {
+		if len(frame) < macSize {
+			return nil, ErrUnauthenticated
+		}
+		data, mac := frame[:len(frame)-macSize], frame[len(frame)-macSize:]
+		if !hmac.Equal(mac, frameMAC(s.key, s.seq, data)) {
+			return nil, ErrUnauthenticated
+		}
+		s.seq++
+		frame = data
+	}
+	return decodeFrame(frame)
+}
@@ -0,0 +1,264 @@
+package transport
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+const inboxSize = 1000
+
+// Network connects the nodes of one process through in-memory channels.
+type Network struct {
+	mu      sync.RWMutex
+	inboxes map[node.ID]chan node.Message
+	// down holds the links that are cut, one entry per direction.
+	down map[link]bool
+	// faults holds the links that are degraded, keyed by both directions.
+	faults map[link]node.Fault
+	// queues holds the send queue of every link that carried a message.
+	queues   map[link]*sendQueue[node.Message]
+	queueCfg QueueConfig
+
+	// done stops the goroutines moving the queues into the inboxes.
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type link struct {
+	from, to node.ID
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		inboxes:  make(map[node.ID]chan node.Message),
+		down:     make(map[link]bool),
+		faults:   make(map[link]node.Fault),
+		queues:   make(map[link]*sendQueue[node.Message]),
+		queueCfg: DefaultQueue,
+		done:     make(chan struct{}),
+	}
+}
+
+// Close stops delivering messages and waits for the goroutines emptying the
+// send queues to exit. Messages sent afterwards are dropped.
+func (nw *Network) Close() {
+	nw.closeOnce.Do(func() {
+		nw.mu.Lock()
+		close(nw.done)
+		nw.mu.Unlock()
+	})
+	nw.wg.Wait()
+}
+
+func (nw *Network) closed() bool {
+	select {
+	case <-nw.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetQueue configures the send queues of links that have not carried a
+// message yet, so it should be called before the nodes run.
+func (nw *Network) SetQueue(cfg QueueConfig) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.queueCfg = cfg
+}
+
+// Join registers id on the network and returns its endpoint.
+func (nw *Network) Join(id node.ID) *Memory {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	inbox, ok := nw.inboxes[id]
+	if !ok {
+		inbox = make(chan node.Message, inboxSize)
+		nw.inboxes[id] = inbox
+	}
+	return &Memory{net: nw, id: id, inbox: inbox}
+}
+
+// Memory is a node's endpoint on a Network.
+type Memory struct {
+	net   *Network
+	id    node.ID
+	inbox chan node.Message
+}
+
+var (
+	_ node.Transport     = (*Memory)(nil)
+	_ node.LinkControl   = (*Memory)(nil)
+	_ node.FaultInjector = (*Memory)(nil)
+	_ node.SendQueues    = (*Memory)(nil)
+)
+
+// Send puts msg into the send queue of the link to to, from where it is
+// moved into the inbox of to in order. It never blocks: a full queue drops a
+// message according to its policy, and the message is dropped if the link is
+// cut or to is not on the network. On a degraded link the message may also
+// be dropped, duplicated or queued later from another goroutine.
+func (m *Memory) Send(to node.ID, msg node.Message) {
+	m.net.mu.RLock()
+	_, ok := m.net.inboxes[to]
+	down := m.net.down[link{m.id, to}]
+	fault := m.net.faults[link{m.id, to}]
+	m.net.mu.RUnlock()
+
+	if !ok || down || m.net.closed() {
+		return
+	}
+	q := m.net.queue(link{m.id, to})
+	if fault == (node.Fault{}) {
+		q.push(msg)
+		return
+	}
+
+	if rand.Float64() < fault.Drop {
+		return
+	}
+	deliver(q, msg, delay(fault))
+	if rand.Float64() < fault.Duplicate {
+		deliver(q, msg, delay(fault))
+	}
+}
+
+func deliver(q *sendQueue[node.Message], msg node.Message, after time.Duration) {
+	if after <= 0 {
+		q.push(msg)
+		return
+	}
+	time.AfterFunc(after, func() { q.push(msg) })
+}
+
+// queue returns the send queue of l, starting the goroutine that empties it
+// into the inbox of l.to on first use. No goroutine is started once the
+// network is closed.
+func (nw *Network) queue(l link) *sendQueue[node.Message] {
+	nw.mu.RLock()
+	q, ok := nw.queues[l]
+	nw.mu.RUnlock()
+	if ok {
+		return q
+	}
+
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	if q, ok := nw.queues[l]; ok {
+		return q
+	}
+	q = newSendQueue[node.Message](nw.queueCfg)
+	nw.queues[l] = q
+	if nw.closed() {
+		return q
+	}
+
+	inbox := nw.inboxes[l.to]
+	nw.wg.Add(1)
+	go func() {
+		defer nw.wg.Done()
+		for {
+			select {
+			case msg := <-q.ch:
+				select {
+				case inbox <- msg:
+				case <-nw.done:
+					return
+				}
+			case <-nw.done:
+				return
+			}
+		}
+	}()
+	return q
+}
+
+func (m *Memory) SendStats(peer node.ID) node.SendStats {
+	m.net.mu.RLock()
+	q, ok := m.net.queues[link{m.id, peer}]
+	m.net.mu.RUnlock()
+	if !ok {
+		return node.SendStats{}
+	}
+	return q.stats()
+}
+
+// delay draws the latency of one message on a degraded link.
+func delay(f node.Fault) time.Duration {
+	d := f.Delay
+	if f.Jitter > 0 {
+		d += rand.N(2*f.Jitter+1) - f.Jitter
+	}
+	if f.Reorder > 0 {
+		d += rand.N(f.Reorder)
+	}
+	return d
+}
+
+func (m *Memory) Receive() <-chan node.Message {
+	return m.inbox
+}
+
+func (m *Memory) Connect(peer node.ID, dir node.Direction) bool {
+	return m.net.setLink(m.id, peer, dir, false)
+}
+
+func (m *Memory) Disconnect(peer node.ID, dir node.Direction) bool {
+	return m.net.setLink(m.id, peer, dir, true)
+}
+
+func (m *Memory) Connected(peer node.ID, dir node.Direction) bool {
+	m.net.mu.RLock()
+	defer m.net.mu.RUnlock()
+
+	out, in := !m.net.down[link{m.id, peer}], !m.net.down[link{peer, m.id}]
+	switch dir {
+	case node.Outbound:
+		return out
+	case node.Inbound:
+		return in
+	}
+	return out && in
+}
+
+func (m *Memory) SetFault(peer node.ID, f node.Fault) bool {
+	nw := m.net
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	if _, ok := nw.inboxes[peer]; !ok {
+		return false
+	}
+	nw.faults[link{m.id, peer}] = f
+	nw.faults[link{peer, m.id}] = f
+	return true
+}
+
+func (m *Memory) Fault(peer node.ID) node.Fault {
+	m.net.mu.RLock()
+	defer m.net.mu.RUnlock()
+	return m.net.faults[link{m.id, peer}]
+}
+
+// setLink cuts or restores the link between a and b as seen from a.
+func (nw *Network) setLink(a, b node.ID, dir node.Direction, down bool) bool {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	if _, ok := nw.inboxes[b]; !ok {
+		return false
+	}
+	if dir != node.Inbound {
+		nw.down[link{a, b}] = down
+	}
+	if dir != node.Outbound {
+		nw.down[link{b, a}] = down
+	}
+	return true
+}
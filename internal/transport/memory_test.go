@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+func TestMemoryLinks(t *testing.T) {
+	nw := NewNetwork()
+	a, b := uuid.New(), uuid.New()
+	ta, tb := nw.Join(a), nw.Join(b)
+
+	vote := func(from, to uuid.UUID) node.Message {
+		return node.Vote{From: from, To: to, Term: 1}
+	}
+
+	ta.Send(b, vote(a, b))
+	require.Equal(t, vote(a, b), <-tb.Receive())
+
+	require.True(t, ta.Disconnect(b, node.Both))
+	require.False(t, ta.Connected(b, node.Both))
+	require.False(t, tb.Connected(a, node.Both))
+
+	ta.Send(b, vote(a, b))
+	tb.Send(a, vote(b, a))
+	require.Empty(t, tb.Receive())
+	require.Empty(t, ta.Receive())
+
+	require.True(t, tb.Connect(a, node.Both))
+	tb.Send(a, vote(b, a))
+	require.Equal(t, vote(b, a), <-ta.Receive())
+
+	require.False(t, ta.Disconnect(uuid.New(), node.Both))
+}
+
+func TestMemoryOneWay(t *testing.T) {
+	nw := NewNetwork()
+	a, b := uuid.New(), uuid.New()
+	ta, tb := nw.Join(a), nw.Join(b)
+
+	vote := func(from, to uuid.UUID) node.Message {
+		return node.Vote{From: from, To: to, Term: 1}
+	}
+
+	// a can no longer reach b, b still reaches a
+	require.True(t, ta.Disconnect(b, node.Outbound))
+	require.False(t, ta.Connected(b, node.Outbound))
+	require.True(t, ta.Connected(b, node.Inbound))
+	require.False(t, ta.Connected(b, node.Both))
+	require.False(t, tb.Connected(a, node.Inbound))
+	require.True(t, tb.Connected(a, node.Outbound))
+
+	ta.Send(b, vote(a, b))
+	require.Empty(t, tb.Receive())
+	tb.Send(a, vote(b, a))
+	require.Equal(t, vote(b, a), <-ta.Receive())
+
+	// cutting the other way from b's side isolates the pair
+	require.True(t, tb.Disconnect(a, node.Outbound))
+	tb.Send(a, vote(b, a))
+	require.Empty(t, ta.Receive())
+
+	require.True(t, ta.Connect(b, node.Inbound))
+	tb.Send(a, vote(b, a))
+	require.Equal(t, vote(b, a), <-ta.Receive())
+	require.False(t, ta.Connected(b, node.Outbound))
+
+	require.True(t, ta.Connect(b, node.Both))
+	require.True(t, tb.Connected(a, node.Both))
+}
+
+func TestMemoryFaults(t *testing.T) {
+	nw := NewNetwork()
+	a, b := uuid.New(), uuid.New()
+	ta, tb := nw.Join(a), nw.Join(b)
+
+	vote := func(term int) node.Message {
+		return node.Vote{From: a, To: b, Term: term}
+	}
+
+	require.True(t, ta.SetFault(b, node.Fault{Drop: 1}))
+	require.Equal(t, node.Fault{Drop: 1}, tb.Fault(a))
+	ta.Send(b, vote(1))
+	require.Empty(t, tb.Receive())
+
+	require.True(t, tb.SetFault(a, node.Fault{Duplicate: 1}))
+	ta.Send(b, vote(2))
+	require.Equal(t, vote(2), <-tb.Receive())
+	require.Equal(t, vote(2), <-tb.Receive())
+
+	require.True(t, ta.SetFault(b, node.Fault{Delay: 50 * time.Millisecond}))
+	start := time.Now()
+	ta.Send(b, vote(3))
+	require.Empty(t, tb.Receive())
+	require.Equal(t, vote(3), <-tb.Receive())
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	require.True(t, ta.SetFault(b, node.Fault{Reorder: 20 * time.Millisecond}))
+	const n = 100
+	for i := range n {
+		ta.Send(b, vote(i))
+	}
+	terms := make([]int, 0, n)
+	for range n {
+		terms = append(terms, (<-tb.Receive()).GetTerm())
+	}
+	require.False(t, slices.IsSorted(terms))
+
+	require.True(t, ta.SetFault(b, node.Fault{}))
+	for i := range n {
+		ta.Send(b, vote(i))
+	}
+	for i := range n {
+		require.Equal(t, vote(i), <-tb.Receive())
+	}
+
+	require.False(t, ta.SetFault(uuid.New(), node.Fault{Drop: 1}))
+}
+
+// TestNetworkClose stops the queue goroutines, including one blocked on an
+// inbox nobody reads.
+func TestNetworkClose(t *testing.T) {
+	nw := NewNetwork()
+	a, b := uuid.New(), uuid.New()
+	ta, tb := nw.Join(a), nw.Join(b)
+
+	for range inboxSize + 10 {
+		ta.Send(b, node.HeartBeat{From: a, To: b, Term: 1})
+	}
+	tb.Send(a, node.HeartBeat{From: b, To: a, Term: 1})
+	require.Eventually(t, func() bool {
+		return len(tb.Receive()) == inboxSize && len(ta.Receive()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		nw.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the queue goroutines")
+	}
+
+	// sending on a closed network drops the message
+	tb.Send(a, node.HeartBeat{From: b, To: a, Term: 2})
+	require.Len(t, ta.Receive(), 1)
+	nw.Close()
+}
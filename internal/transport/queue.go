@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+// DropPolicy decides which message a full send queue gives up.
+type DropPolicy int
+
+const (
+	// DropOldest discards the message that waited longest, so the peer gets
+	// the freshest state once it catches up.
+	DropOldest DropPolicy = iota
+	// DropNewest discards the message being sent.
+	DropNewest
+)
+
+func (p DropPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "oldest"
+	case DropNewest:
+		return "newest"
+	}
+	return fmt.Sprintf("DropPolicy(%d)", int(p))
+}
+
+// ParseDropPolicy parses "oldest" or "newest"; empty means DropOldest.
+func ParseDropPolicy(s string) (DropPolicy, error) {
+	switch s {
+	case "", "oldest":
+		return DropOldest, nil
+	case "newest":
+		return DropNewest, nil
+	}
+	return DropOldest, fmt.Errorf("unknown drop policy `%s`, want oldest or newest", s)
+}
+
+// QueueConfig sizes the per-peer send queues of a transport.
+type QueueConfig struct {
+	Size   int
+	Policy DropPolicy
+}
+
+// DefaultQueue is used by transports that are not configured otherwise.
+var DefaultQueue = QueueConfig{Size: sendQueueSize, Policy: DropOldest}
+
+// sendQueue is a bounded queue of messages for one peer. push never blocks:
+// when the queue is full a message is dropped according to the policy.
+type sendQueue[T any] struct {
+	ch      chan T
+	policy  DropPolicy
+	queued  atomic.Uint64
+	dropped atomic.Uint64
+}
+
+func newSendQueue[T any](cfg QueueConfig) *sendQueue[T] {
+	return &sendQueue[T]{ch: make(chan T, max(cfg.Size, 1)), policy: cfg.Policy}
+}
+
+func (q *sendQueue[T]) push(v T) {
+	for {
+		select {
+		case q.ch <- v:
+			q.queued.Add(1)
+			return
+		default:
+		}
+
+		if q.policy == DropNewest {
+			q.dropped.Add(1)
+			return
+		}
+		select {
+		case <-q.ch:
+			q.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (q *sendQueue[T]) stats() node.SendStats {
+	return node.SendStats{
+		Queued:  q.queued.Load(),
+		Dropped: q.dropped.Load(),
+		Pending: len(q.ch),
+	}
+}
@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+func TestSendQueuePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy DropPolicy
+		queued uint64
+		want   []int
+	}{
+		{DropOldest, 5, []int{3, 4, 5}},
+		{DropNewest, 3, []int{1, 2, 3}},
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			q := newSendQueue[int](QueueConfig{Size: 3, Policy: tc.policy})
+			for i := 1; i <= 5; i++ {
+				q.push(i)
+			}
+			require.Equal(t, node.SendStats{Queued: tc.queued, Dropped: 2, Pending: 3}, q.stats())
+
+			var got []int
+			for range 3 {
+				got = append(got, <-q.ch)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	p, err := ParseDropPolicy("newest")
+	require.NoError(t, err)
+	require.Equal(t, DropNewest, p)
+	_, err = ParseDropPolicy("random")
+	require.Error(t, err)
+}
+
+// TestMemoryPausedPeer checks that a sender never blocks on a peer that stops
+// reading its inbox.
+func TestMemoryPausedPeer(t *testing.T) {
+	nw := NewNetwork()
+	nw.SetQueue(QueueConfig{Size: 10, Policy: DropNewest})
+	a, b := uuid.New(), uuid.New()
+	ta, tb := nw.Join(a), nw.Join(b)
+
+	const n = inboxSize + 100
+	for i := range n {
+		ta.Send(b, node.Vote{From: a, To: b, Term: i})
+	}
+
+	// every message was either queued or dropped, none is stuck in Send
+	s := ta.SendStats(b)
+	require.Equal(t, uint64(n), s.Queued+s.Dropped)
+	require.NotZero(t, s.Dropped)
+	require.Equal(t, 0, (<-tb.Receive()).GetTerm())
+	require.Equal(t, node.SendStats{}, tb.SendStats(a))
+}
@@ -0,0 +1,449 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/peyuaa/raft/internal/node"
+)
+
+const (
+	// maxFrameSize bounds a single message so a corrupt length prefix cannot
+	// make the reader allocate without limit.
+	maxFrameSize  = 64 << 20
+	sendQueueSize = 1000
+
+	dialTimeout = time.Second
+	minBackoff  = 50 * time.Millisecond
+	maxBackoff  = 2 * time.Second
+)
+
+// Wire encodes messages for transports that cross process boundaries.
+type Wire interface {
+	Marshal(node.Message) ([]byte, error)
+	Unmarshal([]byte) (node.Message, error)
+}
+
+// JSON is the default wire encoding, see node.MarshalMessage.
+type JSON struct{}
+
+func (JSON) Marshal(msg node.Message) ([]byte, error) {
+	return node.MarshalMessage(msg)
+}
+
+func (JSON) Unmarshal(data []byte) (node.Message, error) {
+	return node.UnmarshalMessage(data)
+}
+
+// TCP carries messages between processes as length-prefixed frames. Every
+// peer has one pooled outgoing connection fed by its own send queue; a
+// broken connection is redialled with exponential backoff. Large frames may
+// be compressed, see Compression, and connections authenticated, see
+// SetSecret.
+type TCP struct {
+	id    node.ID
+	ln    net.Listener
+	wire  Wire
+	inbox chan node.Message
+
+	mu          sync.Mutex
+	peers       map[node.ID]*peer
+	accepted    map[net.Conn]struct{}
+	queueCfg    QueueConfig
+	compression Compression
+	secret      []byte
+
+	rejected atomic.Uint64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type peer struct {
+	addr  string
+	queue *sendQueue[[]byte]
+}
+
+var (
+	_ node.Transport  = (*TCP)(nil)
+	_ node.SendQueues = (*TCP)(nil)
+	_ node.Rejecter   = (*TCP)(nil)
+)
+
+// ListenTCP starts accepting JSON-encoded messages for id on addr.
+func ListenTCP(id node.ID, addr string) (*TCP, error) {
+	return Listen(id, addr, JSON{})
+}
+
+// Listen starts accepting messages for id on addr. Peers must use the same
+// wire encoding.
+func Listen(id node.ID, addr string, wire Wire) (*TCP, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TCP{
+		id:       id,
+		ln:       ln,
+		wire:     wire,
+		inbox:    make(chan node.Message, inboxSize),
+		peers:    make(map[node.ID]*peer),
+		accepted: make(map[net.Conn]struct{}),
+		queueCfg: DefaultQueue,
+		done:     make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.accept()
+	return t, nil
+}
+
+// Addr returns the address the transport listens on.
+func (t *TCP) Addr() net.Addr {
+	return t.ln.Addr()
+}
+
+// SetQueue configures the send queues of peers added afterwards.
+func (t *TCP) SetQueue(cfg QueueConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queueCfg = cfg
+}
+
+// SetCompression configures compression of the connections dialled or
+// accepted afterwards.
+func (t *TCP) SetCompression(cfg Compression) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.compression = cfg
+}
+
+// SetSecret makes the connections dialled afterwards check that the acceptor
+// holds secret, and authenticates every frame sent or received on new
+// connections, see session. Frames from peers without the secret are
+// refused along with their connection. It should be called before the transport
+// is used.
+func (t *TCP) SetSecret(secret []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.secret = append([]byte(nil), secret...)
+}
+
+func (t *TCP) connConfig() (Compression, []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.compression, t.secret
+}
+
+// features returns the hello features this end supports.
+func features(cfg Compression, secret []byte) byte {
+	f := cfg.features()
+	if secret != nil {
+		f |= featureAuth
+	}
+	return f
+}
+
+// AddPeer makes id reachable at addr.
+func (t *TCP) AddPeer(id node.ID, addr string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.peers[id]; ok {
+		return fmt.Errorf("peer `%v` already exists", id)
+	}
+	p := &peer{addr: addr, queue: newSendQueue[[]byte](t.queueCfg)}
+	t.peers[id] = p
+
+	t.wg.Add(1)
+	go t.send(p)
+	return nil
+}
+
+// Send queues msg for to. The message is dropped if to is unknown or cannot
+// be encoded, and a full queue drops a message according to its policy; Raft
+// retries on its own.
+func (t *TCP) Send(to node.ID, msg node.Message) {
+	t.mu.Lock()
+	p, ok := t.peers[to]
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	frame, err := t.wire.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	p.queue.push(frame)
+}
+
+func (t *TCP) SendStats(peer node.ID) node.SendStats {
+	t.mu.Lock()
+	p, ok := t.peers[peer]
+	t.mu.Unlock()
+	if !ok {
+		return node.SendStats{}
+	}
+	return p.queue.stats()
+}
+
+// Rejected returns how many received frames could not be authenticated or
+// decoded.
+func (t *TCP) Rejected() uint64 {
+	return t.rejected.Load()
+}
+
+func (t *TCP) Receive() <-chan node.Message {
+	return t.inbox
+}
+
+// Close stops the listener and every connection.
+func (t *TCP) Close() error {
+	close(t.done)
+	err := t.ln.Close()
+
+	t.mu.Lock()
+	for conn := range t.accepted {
+		_ = conn.Close()
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	return err
+}
+
+func (t *TCP) send(p *peer) {
+	defer t.wg.Done()
+
+	var conn net.Conn
+	var sess *session
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	backoff := minBackoff
+	for {
+		var frame []byte
+		select {
+		case <-t.done:
+			return
+		case frame = <-p.queue.ch:
+		}
+
+		// a frame that fails on a stale connection gets one retry on a
+		// fresh one
+		for range 2 {
+			for conn == nil {
+				c, err := net.DialTimeout("tcp", p.addr, dialTimeout)
+				if err == nil {
+					sess, err = t.handshake(c)
+					if err == nil {
+						conn, backoff = c, minBackoff
+						break
+					}
+					if errors.Is(err, ErrUnauthenticated) {
+						t.rejected.Add(1)
+					}
+					_ = c.Close()
+				}
+				select {
+				case <-t.done:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, maxBackoff)
+			}
+
+			out := frame
+			if sess != nil {
+				out = sess.seal(frame)
+			}
+			if err := writeFrame(conn, out); err == nil {
+				break
+			}
+			_ = conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// handshake offers the features this end enabled on a freshly dialled
+// connection and returns the session for what the peer agreed to. With a
+// secret the peer must prove it holds it too. With neither compression nor a
+// secret there is nothing to offer: the connection carries plain frames, as
+// raft.proto describes them, and the session is nil.
+func (t *TCP) handshake(conn net.Conn) (*session, error) {
+	cfg, secret := t.connConfig()
+	f := features(cfg, secret)
+	if f == 0 {
+		return nil, nil
+	}
+	offer := newHello(f).frame()
+	if err := writeFrame(conn, offer); err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(dialTimeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	frame, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	h, mac, ok, err := parseHello(frame)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errBadHello
+	}
+
+	sess := &session{enc: newCompressor(h.features, cfg)}
+	if secret == nil {
+		return sess, nil
+	}
+	reply := frame[:helloSize]
+	if h.features&featureAuth == 0 || !hmac.Equal(mac, helloMAC(secret, offer, reply)) {
+		return nil, ErrUnauthenticated
+	}
+	sess.key = frameKey(secret, offer, reply)
+	return sess, nil
+}
+
+// answerHello answers the hello a dialler opened a connection with and returns
+// the session for the frames that follow.
+func (t *TCP) answerHello(conn net.Conn, offer []byte, h hello) (*session, error) {
+	cfg, secret := t.connConfig()
+	if secret != nil && h.features&featureAuth == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	reply := newHello(h.features & features(cfg, secret)).frame()
+	sess := &session{}
+	out := reply
+	if secret != nil {
+		out = append(reply, helloMAC(secret, offer, reply)...)
+		sess.key = frameKey(secret, offer, reply)
+	}
+	if err := writeFrame(conn, out); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (t *TCP) accept() {
+	defer t.wg.Done()
+
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		t.mu.Lock()
+		t.accepted[conn] = struct{}{}
+		t.mu.Unlock()
+
+		t.wg.Add(1)
+		go t.receive(conn)
+	}
+}
+
+func (t *TCP) receive(conn net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		_ = conn.Close()
+		t.mu.Lock()
+		delete(t.accepted, conn)
+		t.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	var sess *session
+	for first := true; ; first = false {
+		frame, err := readFrame(r)
+		if err != nil {
+			return
+		}
+
+		if first {
+			h, _, ok, err := parseHello(frame)
+			if err != nil {
+				t.rejected.Add(1)
+				return
+			}
+			if ok {
+				if sess, err = t.answerHello(conn, frame, h); err != nil {
+					t.rejected.Add(1)
+					return
+				}
+				continue
+			}
+			if _, secret := t.connConfig(); secret != nil {
+				t.rejected.Add(1)
+				return
+			}
+		}
+		if sess != nil {
+			frame, err = sess.open(frame)
+			if errors.Is(err, ErrUnauthenticated) {
+				t.rejected.Add(1)
+				return
+			}
+			if err != nil {
+				t.rejected.Add(1)
+				continue
+			}
+		}
+
+		// frames are length-prefixed, so the connection stays usable after
+		// a malformed one
+		msg, err := t.wire.Unmarshal(frame)
+		if err != nil {
+			t.rejected.Add(1)
+			continue
+		}
+
+		select {
+		case t.inbox <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	buf := make([]byte, 4, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	_, err := w.Write(append(buf, frame...))
+	return err
+}
+
+var errFrameTooLarge = errors.New("frame too large")
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peyuaa/raft/internal/journal"
+	"github.com/peyuaa/raft/internal/node"
+)
+
+func receive(t *testing.T, tr node.Transport) node.Message {
+	t.Helper()
+	select {
+	case msg := <-tr.Receive():
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered")
+		return nil
+	}
+}
+
+func TestTCP(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	ta, err := ListenTCP(a, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ta.Close()
+
+	tb, err := ListenTCP(b, "127.0.0.1:0")
+	require.NoError(t, err)
+	addrB := tb.Addr().String()
+
+	require.NoError(t, ta.AddPeer(b, addrB))
+	require.NoError(t, tb.AddPeer(a, ta.Addr().String()))
+
+	cmd, err := journal.Encode(journal.JSONCodec{}, map[string]string{"key": "value"})
+	require.NoError(t, err)
+	cmd.ID = "req"
+
+	sent := node.AppendEntries{
+		From:        a,
+		To:          b,
+		Term:        3,
+		PrevIndex:   1,
+		PrevTerm:    2,
+		CommitIndex: 1,
+		Entries:     []node.Entry[journal.Command]{{Term: 3, Data: cmd}},
+	}
+	ta.Send(b, sent)
+	require.Equal(t, sent, receive(t, tb))
+
+	reply := node.AppendEntriesResponse{From: b, To: a, Term: 3, Success: true, MatchIndex: 2}
+	tb.Send(a, reply)
+	require.Equal(t, reply, receive(t, ta))
+
+	// b restarts on the same address; a reconnects and keeps delivering
+	require.NoError(t, tb.Close())
+	tb, err = ListenTCP(b, addrB)
+	require.NoError(t, err)
+	defer tb.Close()
+
+	vote := node.Vote{From: a, To: b, Term: 4, VoteGranted: true}
+	require.Eventually(t, func() bool {
+		ta.Send(b, vote)
+		select {
+		case msg := <-tb.Receive():
+			return msg == node.Message(vote)
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestFrame(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		_ = writeFrame(w, []byte("hello"))
+		_ = writeFrame(w, nil)
+	}()
+
+	frame, err := readFrame(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), frame)
+
+	frame, err = readFrame(r)
+	require.NoError(t, err)
+	require.Empty(t, frame)
+}
+
+func TestTCPRejectsMalformed(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	tb, err := ListenTCP(b, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tb.Close()
+
+	conn, err := net.Dial("tcp", tb.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	valid, err := node.MarshalMessage(node.HeartBeat{From: a, To: b, Term: 1})
+	require.NoError(t, err)
+	for _, frame := range [][]byte{
+		[]byte("not json"),
+		[]byte(`{"type":"HeartBeat","data":{"from":"a","to":"b","term":1}}`),
+		[]byte(`{"type":"HeartBeat","data":{"term":1}}`),
+		valid,
+	} {
+		require.NoError(t, writeFrame(conn, frame))
+	}
+
+	// the connection survives the malformed frames
+	require.Equal(t, node.Message(node.HeartBeat{From: a, To: b, Term: 1}), receive(t, tb))
+	require.Equal(t, uint64(3), tb.Rejected())
+}
+
+// TestTCPPlainFrames checks that a transport without compression or a secret
+// sends bare length-prefixed messages, so peers that only implement the wire
+// encoding can read them.
+func TestTCPPlainFrames(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	ta, err := ListenTCP(a, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ta.Close()
+	require.NoError(t, ta.AddPeer(b, ln.Addr().String()))
+
+	sent := node.HeartBeat{From: a, To: b, Term: 1}
+	ta.Send(b, sent)
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	frame, err := readFrame(conn)
+	require.NoError(t, err)
+	msg, err := JSON{}.Unmarshal(frame)
+	require.NoError(t, err)
+	require.Equal(t, node.Message(sent), msg)
+}